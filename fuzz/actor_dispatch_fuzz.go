@@ -0,0 +1,405 @@
+// Fuzzing builtin actor methods dispatched through the specs-actors mock runtime
+// The spec-actor "*Params" registry entries only round-trip their encoding, here the
+// decoded params are handed to the actor method on top of a pre-state reached through
+// the constructor and a few fuzzed calls
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/account"
+	"github.com/filecoin-project/specs-actors/actors/builtin/cron"
+	init_ "github.com/filecoin-project/specs-actors/actors/builtin/init"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/multisig"
+	"github.com/filecoin-project/specs-actors/actors/builtin/paych"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	"github.com/filecoin-project/specs-actors/actors/builtin/reward"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// An address together with the code of the actor behind it
+type actorRef struct {
+	addr goaddr.Address
+	code cid.Cid
+}
+
+// Callers the harnesses construct actors from and call them as
+var (
+	systemCaller   = actorRef{builtin.SystemActorAddr, builtin.SystemActorCodeID}
+	initCaller     = actorRef{builtin.InitActorAddr, builtin.InitActorCodeID}
+	cronCaller     = actorRef{builtin.CronActorAddr, builtin.CronActorCodeID}
+	powerCaller    = actorRef{builtin.StoragePowerActorAddr, builtin.StoragePowerActorCodeID}
+	marketCaller   = actorRef{builtin.StorageMarketActorAddr, builtin.StorageMarketActorCodeID}
+	rewardCaller   = actorRef{builtin.RewardActorAddr, builtin.RewardActorCodeID}
+	accountCallers = []actorRef{
+		{mockrt.IDAddress(100), builtin.AccountActorCodeID},
+		{mockrt.IDAddress(101), builtin.AccountActorCodeID},
+	}
+	minerCaller    = actorRef{mockrt.IDAddress(102), builtin.StorageMinerActorCodeID}
+	multisigCaller = actorRef{mockrt.IDAddress(103), builtin.MultisigActorCodeID}
+)
+
+// Callers the fuzzer picks from. Addresses put in the pre-state are drawn from
+// the same set, so both authorized and unauthorized calls are reached
+var dispatchCallers = []actorRef{
+	systemCaller,
+	initCaller,
+	cronCaller,
+	powerCaller,
+	marketCaller,
+	rewardCaller,
+	accountCallers[0],
+	accountCallers[1],
+	minerCaller,
+	multisigCaller,
+}
+
+// Addresses of the non-singleton actors under test
+var (
+	dispatchAccountAddr  = mockrt.IDAddress(1000)
+	dispatchMultisigAddr = mockrt.IDAddress(1001)
+	dispatchPaychAddr    = mockrt.IDAddress(1002)
+	dispatchMinerAddr    = mockrt.IDAddress(1003)
+)
+
+// Upper bound on the calls made to set up the pre-state
+const maxDispatchSetupCalls = 8
+
+// pickAccount picks one of the account callers
+func pickAccount(f *gfuzz.Fuzzer) goaddr.Address {
+	var i uint8
+	f.Fuzz(&i)
+	return accountCallers[int(i)%len(accountCallers)].addr
+}
+
+// Seal proof of the miners the dispatch harness constructs
+const dispatchSealProof = abi.RegisteredProof_StackedDRG2KiBSeal
+
+// dispatchVerifyPoSt accepts a PoSt unless one of its proofs is empty, so both
+// outcomes are reachable from fuzzed params
+func dispatchVerifyPoSt(info abi.WindowPoStVerifyInfo) error {
+	for _, p := range info.Proofs {
+		if len(p.ProofBytes) == 0 {
+			return fmt.Errorf("empty proof")
+		}
+	}
+	return nil
+}
+
+// An actor the dispatch harness knows how to set up
+// Callers are checked the way the VM does, against what the actor asks for, so
+// nothing here says who may call which method
+type dispatchActor struct {
+	receiver goaddr.Address
+	exports  []interface{}
+	newState func() cbg.CBORUnmarshaler
+	// Runs the constructor with fuzzed params, false if it was rejected
+	construct func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool
+}
+
+// methods returns the methods of an actor that can be dispatched to once it exists
+func (a dispatchActor) methods() []abi.MethodNum {
+	var ms []abi.MethodNum
+	for m, export := range a.exports {
+		if export != nil && abi.MethodNum(m) != builtin.MethodConstructor {
+			ms = append(ms, abi.MethodNum(m))
+		}
+	}
+	return ms
+}
+
+func expectAddr(addrs ...goaddr.Address) func(rt *mockrt.Runtime) {
+	return func(rt *mockrt.Runtime) {
+		rt.ExpectValidateCallerAddr(addrs...)
+	}
+}
+
+// zeroParams returns a typed nil for the params of an actor method,
+// for methods taking *adt.EmptyValue
+func zeroParams(method interface{}) interface{} {
+	return reflect.Zero(reflect.TypeOf(method).In(1)).Interface()
+}
+
+// decodeParams decodes raw into the params type of an actor method
+func decodeParams(method interface{}, raw []byte) (interface{}, bool) {
+	typ := reflect.TypeOf(method).In(1)
+	if typ.Kind() != reflect.Ptr {
+		return nil, false
+	}
+	val := reflect.New(typ.Elem())
+	u, ok := val.Interface().(cbg.CBORUnmarshaler)
+	if !ok {
+		return nil, false
+	}
+	if err := u.UnmarshalCBOR(bytes.NewReader(raw)); err != nil {
+		return nil, false
+	}
+	return val.Interface(), true
+}
+
+// construct calls the constructor of an actor from caller, the way the VM does on creation
+// expect sets up the caller validation, nil when rt validates callers itself
+func construct(rt *mockrt.Runtime, exports []interface{}, caller actorRef, expect func(rt *mockrt.Runtime), params interface{}) bool {
+	rt.SetCaller(caller.addr, caller.code)
+	if expect != nil {
+		expect(rt)
+	}
+	res := mockrt.Invoke(rt, exports[builtin.MethodConstructor], params)
+	rt.Reset()
+	return !res.Aborted && !res.MockFailure
+}
+
+// constructBySystem is the constructor of the singleton actors created at genesis
+func constructBySystem(exports []interface{}) func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+	return func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+		return construct(rt, exports, systemCaller, nil, zeroParams(exports[builtin.MethodConstructor]))
+	}
+}
+
+// The actors under test, by code
+var dispatchActors = map[cid.Cid]dispatchActor{
+	builtin.AccountActorCodeID: {
+		receiver: dispatchAccountAddr,
+		exports:  account.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(account.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			var pub []byte
+			f.Fuzz(&pub)
+			a, err := goaddr.NewSecp256k1Address(pub)
+			if err != nil {
+				return false
+			}
+			return construct(rt, account.Actor{}.Exports(), systemCaller, nil, &a)
+		},
+	},
+	builtin.CronActorCodeID: {
+		receiver: builtin.CronActorAddr,
+		exports:  cron.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(cron.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			var n uint8
+			f.Fuzz(&n)
+			params := &cron.ConstructorParams{Entries: make([]cron.Entry, n%4)}
+			for i := range params.Entries {
+				var idx uint8
+				f.Fuzz(&idx)
+				params.Entries[i].Receiver = dispatchCallers[int(idx)%len(dispatchCallers)].addr
+				f.Fuzz(&params.Entries[i].MethodNum)
+			}
+			return construct(rt, cron.Actor{}.Exports(), systemCaller, nil, params)
+		},
+	},
+	builtin.InitActorCodeID: {
+		receiver: builtin.InitActorAddr,
+		exports:  init_.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(init_.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			params := new(init_.ConstructorParams)
+			f.Fuzz(&params.NetworkName)
+			return construct(rt, init_.Actor{}.Exports(), systemCaller, nil, params)
+		},
+	},
+	builtin.MultisigActorCodeID: {
+		receiver: dispatchMultisigAddr,
+		exports:  multisig.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(multisig.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			var n, threshold uint8
+			var unlock uint16
+			f.Fuzz(&n)
+			f.Fuzz(&threshold)
+			f.Fuzz(&unlock)
+			params := &multisig.ConstructorParams{
+				NumApprovalsThreshold: int64(threshold % 4),
+				UnlockDuration:        abi.ChainEpoch(unlock),
+			}
+			for i := 0; i < int(n%3)+1; i++ {
+				params.Signers = append(params.Signers, pickAccount(f))
+			}
+			return construct(rt, multisig.Actor{}.Exports(), initCaller, nil, params)
+		},
+	},
+	builtin.PaymentChannelActorCodeID: {
+		receiver: dispatchPaychAddr,
+		exports:  paych.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(paych.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			params := &paych.ConstructorParams{From: pickAccount(f), To: pickAccount(f)}
+			return construct(rt, paych.Actor{}.Exports(), initCaller, nil, params)
+		},
+	},
+	builtin.RewardActorCodeID: {
+		receiver:  builtin.RewardActorAddr,
+		exports:   reward.Actor{}.Exports(),
+		newState:  func() cbg.CBORUnmarshaler { return new(reward.State) },
+		construct: constructBySystem(reward.Actor{}.Exports()),
+	},
+	builtin.StoragePowerActorCodeID: {
+		receiver:  builtin.StoragePowerActorAddr,
+		exports:   power.Actor{}.Exports(),
+		newState:  func() cbg.CBORUnmarshaler { return new(power.State) },
+		construct: constructBySystem(power.Actor{}.Exports()),
+	},
+	builtin.StorageMarketActorCodeID: {
+		receiver:  builtin.StorageMarketActorAddr,
+		exports:   market.Actor{}.Exports(),
+		newState:  func() cbg.CBORUnmarshaler { return new(market.State) },
+		construct: constructBySystem(market.Actor{}.Exports()),
+	},
+	builtin.StorageMinerActorCodeID: {
+		receiver: dispatchMinerAddr,
+		exports:  miner.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(miner.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			params := &power.MinerConstructorParams{
+				OwnerAddr:     pickAccount(f),
+				WorkerAddr:    pickAccount(f),
+				SealProofType: dispatchSealProof,
+			}
+			f.Fuzz(&params.PeerId)
+			return construct(rt, miner.Actor{}.Exports(), initCaller, nil, params)
+		},
+	},
+	builtin.VerifiedRegistryActorCodeID: {
+		receiver: builtin.VerifiedRegistryActorAddr,
+		exports:  verifreg.Actor{}.Exports(),
+		newState: func() cbg.CBORUnmarshaler { return new(verifreg.State) },
+		construct: func(rt *mockrt.Runtime, f *gfuzz.Fuzzer) bool {
+			root := pickAccount(f)
+			return construct(rt, verifreg.Actor{}.Exports(), systemCaller, nil, &root)
+		},
+	},
+}
+
+// dispatchSend answers the sends made by dispatched methods. The account callers have
+// a BLS key, power and reward report fixed totals, any other send succeeds returning nothing
+func dispatchSend(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	for _, a := range accountCallers {
+		if to == a.addr && method == builtin.MethodsAccount.PubkeyAddress {
+			var pub [48]byte
+			key, err := goaddr.NewBLSAddress(pub[:])
+			if err != nil {
+				panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+			}
+			return &key, exitcode.Ok
+		}
+	}
+	switch {
+	case to == builtin.StoragePowerActorAddr && method == builtin.MethodsPower.CurrentTotalPower:
+		return &power.CurrentTotalPowerReturn{
+			RawBytePower:     big.NewInt(1 << 40),
+			QualityAdjPower:  big.NewInt(1 << 40),
+			PledgeCollateral: big.Zero(),
+		}, exitcode.Ok
+	case to == builtin.RewardActorAddr && method == builtin.MethodsReward.LastPerEpochReward:
+		r := abi.NewTokenAmount(1e9)
+		return &r, exitcode.Ok
+	}
+	return nil, exitcode.Ok
+}
+
+// dispatchSetup takes the actor from its constructed state through n calls from fuzzed
+// callers to fuzzed methods. Calls that abort are rolled back, so the state is one the
+// chain could have reached. False if the harness didn't model what a call did
+func dispatchSetup(rt *mockrt.Runtime, actor dispatchActor, f *gfuzz.Fuzzer, n int) bool {
+	methods := actor.methods()
+	for i := 0; i < n; i++ {
+		var methodIdx, callerIdx uint8
+		var raw []byte
+		f.Fuzz(&methodIdx)
+		f.Fuzz(&callerIdx)
+		f.Fuzz(&raw)
+		m := methods[int(methodIdx)%len(methods)]
+		params, ok := decodeParams(actor.exports[m], raw)
+		if !ok {
+			continue
+		}
+		caller := dispatchCallers[int(callerIdx)%len(dispatchCallers)]
+		rt.SetCaller(caller.addr, caller.code)
+		rt.SetReceived(big.Zero())
+		if res := mockrt.InvokeReverting(rt, actor.newState, actor.exports[m], params); res.MockFailure {
+			return false
+		}
+	}
+	return true
+}
+
+// Fuzzing actor method dispatch from an actor code, method number and params byteslice
+// The input starts with the code CID of the actor, the rest is handed to gofuzz.
+// Whatever the params and caller, the actor has to either return or abort with a
+// non-zero exit code leaving its state untouched, a Go runtime error is a bug
+func FuzzActorDispatch(data []byte) int {
+	n, code, err := cid.CidFromBytes(data)
+	if err != nil {
+		return 0
+	}
+	actor, ok := dispatchActors[code]
+	if !ok {
+		return 0
+	}
+
+	f := gfuzz.NewFromGoFuzz(data[n:]).NilChance(0)
+	var methodNum, callerIdx, nSetup uint8
+	var epoch, balance, received uint32
+	var raw []byte
+	f.Fuzz(&methodNum)
+	f.Fuzz(&callerIdx)
+	f.Fuzz(&epoch)
+	f.Fuzz(&balance)
+	f.Fuzz(&received)
+	f.Fuzz(&raw)
+	f.Fuzz(&nSetup)
+
+	if int(methodNum) >= len(actor.exports) || actor.exports[methodNum] == nil || abi.MethodNum(methodNum) == builtin.MethodConstructor {
+		return 0
+	}
+	method := actor.exports[methodNum]
+	params, ok := decodeParams(method, raw)
+	if !ok {
+		return 0
+	}
+
+	rt := mockrt.NewRuntime(actor.receiver, abi.ChainEpoch(epoch), abi.NewTokenAmount(int64(balance)))
+	rt.OnSend = dispatchSend
+	rt.VerifyPoSt = dispatchVerifyPoSt
+	rt.ValidateCallers = true
+	for _, c := range dispatchCallers {
+		rt.SetAddressActorType(c.addr, c.code)
+	}
+	if !actor.construct(rt, f) {
+		return 0
+	}
+	if !dispatchSetup(rt, actor, f, int(nSetup)%maxDispatchSetupCalls) {
+		return 0
+	}
+
+	caller := dispatchCallers[int(callerIdx)%len(dispatchCallers)]
+	rt.SetCaller(caller.addr, caller.code)
+	rt.SetReceived(abi.NewTokenAmount(int64(received)))
+	rt.SetBalance(big.Add(rt.Balance, abi.NewTokenAmount(int64(received))))
+
+	res := mockrt.InvokeChecked(rt, actor.newState, method, params)
+	if res.MockFailure {
+		// e.g. a syscall the harness doesn't model
+		return 0
+	}
+	if !res.Aborted && !rt.CallerValidated {
+		panic(fmt.Sprintf("method %d of actor %s returned without validating its caller", methodNum, code))
+	}
+	return 1
+}
@@ -0,0 +1,183 @@
+// Differential fuzzing of go-address parsing
+// The string, bytes and JSON forms are parsed by different code paths, these
+// harnesses check they accept and reject the same addresses and round-trip
+
+package fuzz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	goaddr "github.com/filecoin-project/go-address"
+)
+
+// Both network prefixes are accepted whatever goaddr.CurrentNetwork is
+var addressPrefixes = []string{goaddr.TestnetPrefix, goaddr.MainnetPrefix}
+
+// checkAddress checks the invariants of an address either parser accepted
+func checkAddress(a goaddr.Address) {
+	payload := a.Payload()
+	switch a.Protocol() {
+	case goaddr.ID:
+		// the payload is a leb128 uint64, with no redundant trailing bytes
+		id, n := binary.Uvarint(payload)
+		if n <= 0 || n != len(payload) {
+			panic(fmt.Sprintf("ID address with invalid leb128 payload %x", payload))
+		}
+		buf := make([]byte, binary.MaxVarintLen64)
+		if !bytes.Equal(buf[:binary.PutUvarint(buf, id)], payload) {
+			panic(fmt.Sprintf("ID address with non-canonical leb128 payload %x", payload))
+		}
+	case goaddr.SECP256K1, goaddr.Actor:
+		if len(payload) != goaddr.PayloadHashLength {
+			panic(fmt.Sprintf("protocol %d address with %d byte payload", a.Protocol(), len(payload)))
+		}
+	case goaddr.BLS:
+		if len(payload) != goaddr.BlsPublicKeyBytes {
+			panic(fmt.Sprintf("BLS address with %d byte payload", len(payload)))
+		}
+	default:
+		panic(fmt.Sprintf("address with unknown protocol %d accepted", a.Protocol()))
+	}
+
+	// String and bytes round-trip
+	fromBytes, err := goaddr.NewFromBytes(a.Bytes())
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't parse the bytes of %s: %v", a, err))
+	}
+	if fromBytes != a {
+		panic(fmt.Sprintf("bytes round-trip of %s gave %s", a, fromBytes))
+	}
+	s := a.String()
+	for _, prefix := range addressPrefixes {
+		fromString, err := goaddr.NewFromString(prefix + s[1:])
+		if err != nil {
+			panic(fmt.Sprintf("Couldn't parse %s with prefix %q: %v", s, prefix, err))
+		}
+		if fromString != a {
+			panic(fmt.Sprintf("string round-trip of %s with prefix %q gave %s", s, prefix, fromString))
+		}
+	}
+
+	// JSON round-trip
+	raw, err := json.Marshal(a)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't marshal %s: %v", a, err))
+	}
+	var fromJSON goaddr.Address
+	if err := json.Unmarshal(raw, &fromJSON); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	if fromJSON != a {
+		panic(fmt.Sprintf("JSON round-trip of %s gave %s", a, fromJSON))
+	}
+}
+
+// rawAddressString builds the string form of raw address bytes without any validation,
+// ok is false if the bytes can't be written as a string at all
+func rawAddressString(prefix string, raw []byte) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+	protocol, payload := raw[0], raw[1:]
+	if protocol == goaddr.ID {
+		// only canonical leb128 has a string form, anything else would
+		// write out the bytes of a different address
+		id, n := binary.Uvarint(payload)
+		if n <= 0 || n != len(payload) {
+			return "", false
+		}
+		buf := make([]byte, binary.MaxVarintLen64)
+		if !bytes.Equal(buf[:binary.PutUvarint(buf, id)], payload) {
+			return "", false
+		}
+		return prefix + "0" + strconv.FormatUint(id, 10), true
+	}
+	// copy, appending to payload would write into the fuzzer's input
+	buf := append(append([]byte{}, payload...), goaddr.Checksum(raw)...)
+	return prefix + strconv.Itoa(int(protocol)) + goaddr.AddressEncoding.EncodeToString(buf), true
+}
+
+// Fuzzing NewFromString, a string that parses has to be the canonical form of its address
+func FuzzAddressFromString(data []byte) int {
+	s := string(data)
+	a, err := goaddr.NewFromString(s)
+	if err != nil {
+		return 0
+	}
+	checkAddress(a)
+	// The prefix may differ from CurrentNetwork, the rest must be canonical,
+	// otherwise two strings name the same address
+	if canonical := a.String(); len(s) < 1 || s[1:] != canonical[1:] {
+		panic(fmt.Sprintf("non-canonical string %q accepted for %s", s, canonical))
+	}
+	return 1
+}
+
+// Fuzzing NewFromBytes against NewFromString of the same raw address
+// Both parsers have to agree on which addresses are valid
+func FuzzAddressFromBytes(data []byte) int {
+	a, err := goaddr.NewFromBytes(data)
+	if err == nil {
+		checkAddress(a)
+	}
+
+	str, ok := rawAddressString(goaddr.TestnetPrefix, data)
+	if !ok {
+		if err == nil {
+			panic(fmt.Sprintf("NewFromBytes accepted %x, which has no string form", data))
+		}
+		return 0
+	}
+	fromString, errString := goaddr.NewFromString(str)
+	switch {
+	case err == nil && errString != nil:
+		panic(fmt.Sprintf("NewFromBytes accepted %x, NewFromString rejected %q: %v", data, str, errString))
+	case err != nil && errString == nil:
+		panic(fmt.Sprintf("NewFromString accepted %q, NewFromBytes rejected %x: %v", str, data, err))
+	case err == nil && fromString != a:
+		panic(fmt.Sprintf("NewFromBytes gave %s, NewFromString gave %s", a, fromString))
+	}
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing Address UnmarshalJSON, which has to agree with NewFromString
+func FuzzAddressJSON(data []byte) int {
+	var a goaddr.Address
+	err := json.Unmarshal(data, &a)
+
+	var s string
+	if json.Unmarshal(data, &s) != nil {
+		if err == nil {
+			panic(fmt.Sprintf("UnmarshalJSON accepted %q, which isn't a JSON string", data))
+		}
+		return 0
+	}
+	// UnmarshalJSON reads the marshalled form of Undef back, NewFromString doesn't
+	if s == goaddr.UndefAddressString {
+		if err != nil || a != goaddr.Undef {
+			panic(fmt.Sprintf("UnmarshalJSON(%s) = %s, %v, want Undef", data, a, err))
+		}
+		return 0
+	}
+	fromString, errString := goaddr.NewFromString(s)
+	switch {
+	case err == nil && errString != nil:
+		panic(fmt.Sprintf("UnmarshalJSON accepted %s, NewFromString rejected it: %v", data, errString))
+	case err != nil && errString == nil:
+		panic(fmt.Sprintf("NewFromString accepted %q, UnmarshalJSON rejected it: %v", s, err))
+	case err == nil && fromString != a:
+		panic(fmt.Sprintf("UnmarshalJSON gave %s, NewFromString gave %s", a, fromString))
+	}
+	if err != nil {
+		return 0
+	}
+	checkAddress(a)
+	return 1
+}
@@ -0,0 +1,242 @@
+// Stateful fuzzing of go-amt-ipld against a sparse array reference model
+// The fuzz data is interpreted as a sequence of operations applied to both,
+// any disagreement between the two is a bug in the AMT
+
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	amtipld "github.com/filecoin-project/go-amt-ipld"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+const (
+	amtOpSet = iota
+	amtOpGet
+	amtOpDelete
+	amtOpBatchDelete
+	amtOpForEach
+	amtOpFlush
+	amtOpReload
+	numAmtOps
+)
+
+// Regions an index is drawn from, uniformly random indexes would almost never
+// collide or land next to MaxIndex
+const (
+	amtIndexSmall = iota
+	amtIndexNearMax
+	amtIndexRaw
+	numAmtIndexKinds
+)
+
+// A single operation decoded from fuzz data
+type amtOp struct {
+	Kind      uint8
+	IndexKind uint8
+	Index     uint64
+	Value     int64
+}
+
+func (op amtOp) index() uint64 {
+	switch int(op.IndexKind) % numAmtIndexKinds {
+	case amtIndexSmall:
+		return op.Index % 512
+	case amtIndexNearMax:
+		// MaxIndex itself and a few past it are out of range
+		return amtipld.MaxIndex - 8 + op.Index%16
+	default:
+		return op.Index
+	}
+}
+
+// amtHeightFor returns the smallest height holding every index up to maxIndex
+func amtHeightFor(maxIndex uint64) uint64 {
+	var height uint64
+	for maxIndex >= nodesForHeight(width, int(height+1)) {
+		height++
+	}
+	return height
+}
+
+func sortedAmtIndexes(model map[uint64]int64) []uint64 {
+	idxs := make([]uint64, 0, len(model))
+	for i := range model {
+		idxs = append(idxs, i)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+	return idxs
+}
+
+// amtRootFromModel builds a fresh AMT holding the contents of model and returns its root CID
+func amtRootFromModel(ctx context.Context, model map[uint64]int64) cid.Cid {
+	r := amtipld.NewAMT(newIpldStore())
+	for _, i := range sortedAmtIndexes(model) {
+		v := cbg.CborInt(model[i])
+		if err := r.Set(ctx, i, &v); err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't set %d: %v", i, err))
+		}
+	}
+	c, err := r.Flush(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("Flush of model AMT failed: %v", err))
+	}
+	return c
+}
+
+// checkAmtGet compares a single lookup against the model
+func checkAmtGet(ctx context.Context, r *amtipld.Root, model map[uint64]int64, i uint64) {
+	var out cbg.CborInt
+	err := r.Get(ctx, i, &out)
+	want, ok := model[i]
+	switch {
+	case ok && err != nil:
+		panic(fmt.Sprintf("Get(%d) failed for present index: %v", i, err))
+	case !ok && err == nil:
+		panic(fmt.Sprintf("Get(%d) found a deleted or never set index: %d", i, out))
+	case ok && int64(out) != want:
+		panic(fmt.Sprintf("Get(%d) = %d, want %d", i, out, want))
+	}
+}
+
+// checkAmtShape compares the count and height with what the model implies.
+// Delete only shrinks the tree while the first slot is the only one set, so the
+// height may stay above what the largest index needs but never below it
+func checkAmtShape(r *amtipld.Root, model map[uint64]int64) {
+	if r.Count != uint64(len(model)) {
+		panic(fmt.Sprintf("Count = %d, model holds %d", r.Count, len(model)))
+	}
+	var want uint64
+	if idxs := sortedAmtIndexes(model); len(idxs) > 0 {
+		want = amtHeightFor(idxs[len(idxs)-1])
+	}
+	if r.Height < want {
+		panic(fmt.Sprintf("Height = %d, need at least %d for %d entries", r.Height, want, len(model)))
+	}
+}
+
+// Fuzzing go-amt-ipld Set/Get/Delete/BatchDelete/ForEach/Flush/reload against a sparse array
+func FuzzAmtOps(data []byte) int {
+	ctx := context.Background()
+	var ops []amtOp
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&ops)
+	if len(ops) == 0 {
+		return 0
+	}
+
+	bs := newIpldStore()
+	r := amtipld.NewAMT(bs)
+	model := make(map[uint64]int64)
+	// Root and contents as of the last flush, to reload from
+	var root cid.Cid
+	var flushed map[uint64]int64
+
+	for _, op := range ops {
+		i := op.index()
+		switch int(op.Kind) % numAmtOps {
+		case amtOpSet:
+			v := cbg.CborInt(op.Value)
+			err := r.Set(ctx, i, &v)
+			if i >= amtipld.MaxIndex {
+				if err == nil {
+					panic(fmt.Sprintf("Set(%d) succeeded past MaxIndex", i))
+				}
+				break
+			}
+			if err != nil {
+				panic(fmt.Sprintf("Set(%d) failed: %v", i, err))
+			}
+			model[i] = op.Value
+		case amtOpGet:
+			// checked below after every op
+		case amtOpDelete:
+			err := r.Delete(ctx, i)
+			if _, ok := model[i]; ok && err != nil {
+				panic(fmt.Sprintf("Delete(%d) failed for present index: %v", i, err))
+			} else if !ok && err == nil {
+				panic(fmt.Sprintf("Delete(%d) succeeded for missing index", i))
+			}
+			delete(model, i)
+		case amtOpBatchDelete:
+			// Only present indexes, BatchDelete stops half way through on a missing one
+			idxs := sortedAmtIndexes(model)
+			if len(idxs) == 0 {
+				break
+			}
+			start := int(op.Index % uint64(len(idxs)))
+			end := start + int(op.Value&0xf)
+			if end > len(idxs) {
+				end = len(idxs)
+			}
+			batch := idxs[start:end]
+			if err := r.BatchDelete(ctx, batch); err != nil {
+				panic(fmt.Sprintf("BatchDelete(%v) failed: %v", batch, err))
+			}
+			for _, j := range batch {
+				delete(model, j)
+			}
+		case amtOpForEach:
+			var prev uint64
+			seen := 0
+			err := r.ForEach(ctx, func(j uint64, val *cbg.Deferred) error {
+				var v cbg.CborInt
+				if err := v.UnmarshalCBOR(bytes.NewReader(val.Raw)); err != nil {
+					return err
+				}
+				if seen > 0 && j <= prev {
+					panic(fmt.Sprintf("ForEach out of order: %d after %d", j, prev))
+				}
+				if want, ok := model[j]; !ok || want != int64(v) {
+					panic(fmt.Sprintf("ForEach gave %d=%d, model has %d (present: %v)", j, v, want, ok))
+				}
+				prev = j
+				seen++
+				return nil
+			})
+			if err != nil {
+				panic(fmt.Sprintf("ForEach failed: %v", err))
+			}
+			if seen != len(model) {
+				panic(fmt.Sprintf("ForEach visited %d indexes, model holds %d", seen, len(model)))
+			}
+		case amtOpFlush:
+			c, err := r.Flush(ctx)
+			if err != nil {
+				panic(fmt.Sprintf("Flush failed: %v", err))
+			}
+			checkAmtShape(r, model)
+			// Equal contents have to give the same root, whatever the history
+			if want := amtRootFromModel(ctx, model); !want.Equals(c) {
+				panic(fmt.Sprintf("Root %s differs from root %s of the same contents", c, want))
+			}
+			root = c
+			flushed = make(map[uint64]int64, len(model))
+			for j, v := range model {
+				flushed[j] = v
+			}
+		case amtOpReload:
+			if !root.Defined() {
+				break
+			}
+			loaded, err := amtipld.LoadAMT(ctx, bs, root)
+			if err != nil {
+				panic(fmt.Sprintf("LoadAMT of flushed root failed: %v", err))
+			}
+			// Unflushed changes are dropped, go back to the model as it was at the flush
+			r = loaded
+			model = make(map[uint64]int64, len(flushed))
+			for j, v := range flushed {
+				model[j] = v
+			}
+			checkAmtShape(r, model)
+		}
+		checkAmtGet(ctx, r, model, i)
+	}
+	return 1
+}
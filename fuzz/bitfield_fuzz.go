@@ -0,0 +1,260 @@
+// Fuzzing go-bitfield, the RLE+ bitfields carried by miner actor params
+// like DeclareFaultsParams and TerminateSectorsParams
+// Decoding, round-trips and set algebra are checked against a map[uint64]struct{} model
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-bitfield"
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	gfuzz "github.com/google/gofuzz"
+)
+
+// Limit passed to All, large enough for anything the set ops generate
+// but far below what a crafted run can expand to
+const bitfieldAllLimit = 1 << 16
+
+type bitSet map[uint64]struct{}
+
+func newBitSet(bits []uint64) bitSet {
+	s := make(bitSet, len(bits))
+	for _, b := range bits {
+		s[b] = struct{}{}
+	}
+	return s
+}
+
+func (s bitSet) sorted() []uint64 {
+	out := make([]uint64, 0, len(s))
+	for b := range s {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// checkBitfieldMatches compares every way of reading bf with the model
+func checkBitfieldMatches(what string, bf bitfield.BitField, want bitSet) {
+	count, err := bf.Count()
+	if err != nil {
+		panic(fmt.Sprintf("%s: Count failed: %v", what, err))
+	}
+	if count != uint64(len(want)) {
+		panic(fmt.Sprintf("%s: Count = %d, want %d", what, count, len(want)))
+	}
+	all, err := bf.All(bitfieldAllLimit)
+	if err != nil {
+		panic(fmt.Sprintf("%s: All failed: %v", what, err))
+	}
+	sorted := want.sorted()
+	if len(all) != len(sorted) {
+		panic(fmt.Sprintf("%s: All returned %d bits, want %d", what, len(all), len(sorted)))
+	}
+	for i := range all {
+		if all[i] != sorted[i] {
+			panic(fmt.Sprintf("%s: All()[%d] = %d, want %d", what, i, all[i], sorted[i]))
+		}
+	}
+	for _, b := range sorted {
+		if set, err := bf.IsSet(b); err != nil || !set {
+			panic(fmt.Sprintf("%s: IsSet(%d) = %v, %v for a set bit", what, b, set, err))
+		}
+	}
+}
+
+// Fuzzing bitfield decoding from raw RLE+ bytes
+func FuzzBitfieldRaw(data []byte) int {
+	bf, err := bitfield.NewFromBytes(data)
+	if err != nil {
+		return 0
+	}
+	count, err := bf.Count()
+	if err != nil {
+		// Runs can add up past MaxUint64
+		return 0
+	}
+
+	// All has to respect its limit rather than expand huge runs
+	all, err := bf.All(bitfieldAllLimit)
+	if count > bitfieldAllLimit {
+		if err == nil {
+			panic(fmt.Sprintf("All(%d) succeeded on %d bits", bitfieldAllLimit, count))
+		}
+		return 0
+	}
+	if err != nil {
+		panic(fmt.Sprintf("All failed within its limit: %v", err))
+	}
+	checkBitfieldMatches("decoded", bf, newBitSet(all))
+
+	// Re-encoding is canonical, so the set and the decoded field encode the same
+	buf := new(bytes.Buffer)
+	if err := bf.MarshalCBOR(buf); err != nil {
+		panic(fmt.Sprintf("Should be able to successfully marshal something we unmarshalled.\nErr: %v", err))
+	}
+	buf1 := new(bytes.Buffer)
+	fromSet := bitfield.NewFromSet(all)
+	if err := fromSet.MarshalCBOR(buf1); err != nil {
+		panic(fmt.Sprintf("Couldn't marshal bitfield made from a set: %v", err))
+	}
+	if !bytes.Equal(buf.Bytes(), buf1.Bytes()) {
+		fmt.Printf("decoded: %x\n", buf.Bytes())
+		fmt.Printf("from set: %x\n", buf1.Bytes())
+		panic("re-encoding isn't canonical")
+	}
+
+	var bf1 bitfield.BitField
+	if err := bf1.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	checkBitfieldMatches("round-tripped", bf1, newBitSet(all))
+	return 1
+}
+
+// Input for the set algebra harness
+type bitfieldSetOpsInput struct {
+	A, B []uint64
+	// Bits are capped to bitfieldAllLimit, then spread out by shifting so runs
+	// of all sizes and large bit positions show up
+	ShiftA, ShiftB uint8
+}
+
+func spreadBits(bits []uint64, shift uint8) []uint64 {
+	out := make([]uint64, len(bits))
+	for i, b := range bits {
+		out[i] = (b % bitfieldAllLimit) << (shift % 40)
+	}
+	return out
+}
+
+// Fuzzing Merge/Intersect/Subtract/Count/All against a map model
+func FuzzBitfieldSetOps(data []byte) int {
+	var in bitfieldSetOpsInput
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&in)
+	a := spreadBits(in.A, in.ShiftA)
+	b := spreadBits(in.B, in.ShiftB)
+	setA, setB := newBitSet(a), newBitSet(b)
+	bfA, bfB := bitfield.NewFromSet(a), bitfield.NewFromSet(b)
+	checkBitfieldMatches("A", bfA, setA)
+	checkBitfieldMatches("B", bfB, setB)
+
+	union, inter, diff := make(bitSet), make(bitSet), make(bitSet)
+	for x := range setA {
+		union[x] = struct{}{}
+		if _, ok := setB[x]; ok {
+			inter[x] = struct{}{}
+		} else {
+			diff[x] = struct{}{}
+		}
+	}
+	for x := range setB {
+		union[x] = struct{}{}
+	}
+
+	merged, err := bitfield.MergeBitFields(bfA, bfB)
+	if err != nil {
+		panic(fmt.Sprintf("MergeBitFields failed: %v", err))
+	}
+	checkBitfieldMatches("A|B", merged, union)
+
+	intersected, err := bitfield.IntersectBitField(bfA, bfB)
+	if err != nil {
+		panic(fmt.Sprintf("IntersectBitField failed: %v", err))
+	}
+	checkBitfieldMatches("A&B", intersected, inter)
+
+	subtracted, err := bitfield.SubtractBitField(bfA, bfB)
+	if err != nil {
+		panic(fmt.Sprintf("SubtractBitField failed: %v", err))
+	}
+	checkBitfieldMatches("A-B", subtracted, diff)
+
+	// All with a limit below the count must fail rather than truncate
+	if len(union) > 0 {
+		if _, err := merged.All(uint64(len(union) - 1)); err == nil {
+			panic(fmt.Sprintf("All(%d) succeeded on %d bits", len(union)-1, len(union)))
+		}
+	}
+	return 1
+}
+
+// Fuzzing bitfields made of arbitrary, possibly huge, runs
+// Count and set operations must work on the runs without expanding them
+func FuzzBitfieldRuns(data []byte) int {
+	var runs []rlepluslazy.Run
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&runs)
+
+	// RLE+ only stores the value of the first run, each following run flips it,
+	// so the runs have to alternate and be non-empty to mean what they say
+	normalized := runs[:0]
+	for _, r := range runs {
+		if r.Len == 0 {
+			continue
+		}
+		if len(normalized) > 0 {
+			r.Val = !normalized[len(normalized)-1].Val
+		}
+		normalized = append(normalized, r)
+	}
+	runs = normalized
+
+	rle, err := rlepluslazy.EncodeRuns(&rlepluslazy.RunSliceIterator{Runs: runs}, nil)
+	if err != nil {
+		return 0
+	}
+	bf, err := bitfield.NewFromBytes(rle)
+	if err != nil {
+		panic(fmt.Sprintf("should be able to decode runs we encoded. Err: %v", err))
+	}
+
+	var want uint64
+	overflow := false
+	for _, r := range runs {
+		if !r.Val {
+			continue
+		}
+		if want+r.Len < want {
+			overflow = true
+		}
+		want += r.Len
+	}
+	count, err := bf.Count()
+	if overflow {
+		if err == nil {
+			panic(fmt.Sprintf("Count succeeded with %d for runs adding up past MaxUint64", count))
+		}
+		return 0
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Count failed: %v", err))
+	}
+	if count != want {
+		panic(fmt.Sprintf("Count = %d, runs add up to %d", count, want))
+	}
+	if count > bitfieldAllLimit {
+		if _, err := bf.All(bitfieldAllLimit); err == nil {
+			panic(fmt.Sprintf("All(%d) succeeded on %d bits", bitfieldAllLimit, count))
+		}
+	}
+
+	// Merging with itself or subtracting itself is cheap on runs
+	merged, err := bitfield.MergeBitFields(bf, bf)
+	if err != nil {
+		panic(fmt.Sprintf("MergeBitFields failed: %v", err))
+	}
+	if mc, err := merged.Count(); err != nil || mc != count {
+		panic(fmt.Sprintf("A|A has %d bits (err %v), A has %d", mc, err, count))
+	}
+	subtracted, err := bitfield.SubtractBitField(bf, bf)
+	if err != nil {
+		panic(fmt.Sprintf("SubtractBitField failed: %v", err))
+	}
+	if sc, err := subtracted.Count(); err != nil || sc != 0 {
+		panic(fmt.Sprintf("A-A has %d bits (err %v)", sc, err))
+	}
+	return 1
+}
@@ -0,0 +1,142 @@
+// Fuzzing of cron actor epoch ticks against callees that fail
+// Cron is constructed with a fuzzed entry table and ticked on mockrt.Runtime, where each
+// send exits with a fuzzed code
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/cron"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Upper bound on the entries in the cron table
+const maxCronEntries = 16
+
+// Receivers the entries point at, the genesis ones and actors that may not exist
+var cronReceivers = []goaddr.Address{
+	builtin.StoragePowerActorAddr,
+	builtin.StorageMarketActorAddr,
+	builtin.RewardActorAddr,
+	builtin.CronActorAddr,
+	mockrt.IDAddress(100),
+	mockrt.IDAddress(1000),
+}
+
+// An entry as the fuzzer generates it
+type cronEntry struct {
+	Receiver uint8
+	Method   uint64
+}
+
+// One epoch tick, with the exit code of each callee in turn, Ok once they run out
+type cronTick struct {
+	Advance uint16
+	Exits   []uint8
+}
+
+func newCronState() cbg.CBORUnmarshaler {
+	return new(cron.State)
+}
+
+// A send cron made during a tick
+type cronCall struct {
+	to     goaddr.Address
+	method abi.MethodNum
+}
+
+// cronCallees answers cron's sends with the exit codes of the current tick
+type cronCallees struct {
+	exits []uint8
+	calls []cronCall
+}
+
+func (c *cronCallees) send(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	if !value.IsZero() {
+		panic(fmt.Sprintf("cron sent %s to %s", value, to))
+	}
+	code := exitcode.Ok
+	if n := len(c.calls); n < len(c.exits) {
+		code = exitcode.ExitCode(c.exits[n])
+	}
+	c.calls = append(c.calls, cronCall{to, method})
+	return nil, code
+}
+
+// Fuzzing cron EpochTick, every entry must be called once per tick in order whatever
+// the earlier ones exit with, and the table must be left as it was
+func FuzzCronEpochTick(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var fuzzed []cronEntry
+	var ticks []cronTick
+	f.Fuzz(&fuzzed)
+	f.Fuzz(&ticks)
+	if len(fuzzed) > maxCronEntries {
+		fuzzed = fuzzed[:maxCronEntries]
+	}
+	if len(ticks) > maxScenarioSteps {
+		ticks = ticks[:maxScenarioSteps]
+	}
+
+	params := &cron.ConstructorParams{}
+	for _, e := range fuzzed {
+		params.Entries = append(params.Entries, cron.Entry{
+			Receiver:  cronReceivers[int(e.Receiver)%len(cronReceivers)],
+			MethodNum: abi.MethodNum(e.Method),
+		})
+	}
+
+	rt := mockrt.NewRuntime(builtin.CronActorAddr, 0, big.Zero())
+	callees := &cronCallees{}
+	rt.OnSend = callees.send
+	actor := cron.Actor{}
+
+	rt.SetCaller(builtin.SystemActorAddr, builtin.SystemActorCodeID)
+	rt.ExpectValidateCallerAddr(builtin.SystemActorAddr)
+	res := mockrt.InvokeReverting(rt, newCronState, actor.Constructor, params)
+	if res.MockFailure || res.Aborted {
+		return 0
+	}
+	table := mockrt.StateBytes(rt, newCronState())
+
+	epoch := abi.ChainEpoch(0)
+	for _, tick := range ticks {
+		epoch += abi.ChainEpoch(tick.Advance)
+		rt.SetEpoch(epoch)
+		callees.exits, callees.calls = tick.Exits, nil
+
+		rt.SetCaller(builtin.SystemActorAddr, builtin.SystemActorCodeID)
+		rt.ExpectValidateCallerAddr(builtin.SystemActorAddr)
+		res = mockrt.InvokeReverting(rt, newCronState, actor.EpochTick, (*adt.EmptyValue)(nil))
+		if res.MockFailure {
+			return 0
+		}
+		if res.Aborted {
+			panic(fmt.Sprintf("EpochTick aborted with %d, exits %v", res.Code, tick.Exits))
+		}
+
+		if len(callees.calls) != len(params.Entries) {
+			panic(fmt.Sprintf("EpochTick made %d calls for %d entries, exits %v", len(callees.calls), len(params.Entries), tick.Exits))
+		}
+		for i, e := range params.Entries {
+			if c := callees.calls[i]; c.to != e.Receiver || c.method != e.MethodNum {
+				panic(fmt.Sprintf("call %d went to %s method %d, entry is %s method %d", i, c.to, c.method, e.Receiver, e.MethodNum))
+			}
+		}
+		if after := mockrt.StateBytes(rt, newCronState()); !bytes.Equal(table, after) {
+			panic("EpochTick changed the cron table")
+		}
+	}
+	return 1
+}
@@ -0,0 +1,180 @@
+// Stateful fuzzing of go-hamt-ipld against a plain Go map
+// The fuzz data is interpreted as a sequence of operations applied to both,
+// any disagreement between the two is a bug in the HAMT
+
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	hamt "github.com/ipfs/go-hamt-ipld"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+const (
+	hamtOpSet = iota
+	hamtOpDelete
+	hamtOpFind
+	hamtOpForEach
+	hamtOpFlush
+	numHamtOps
+)
+
+// A small key space makes the fuzzer hit existing keys, bucket overflows and collapses
+const hamtKeySpace = 1024
+
+// A single operation decoded from fuzz data
+type hamtOp struct {
+	Kind  uint8
+	Key   uint16
+	Value int64
+}
+
+func (op hamtOp) key() string {
+	return strconv.Itoa(int(op.Key) % hamtKeySpace)
+}
+
+func newIpldStore() cbor.IpldStore {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	return cbor.NewCborStore(bs)
+}
+
+// hamtRootFromModel builds a fresh HAMT holding the contents of model, inserted
+// in the given key order, and returns its flushed root CID
+func hamtRootFromModel(ctx context.Context, model map[string]int64, keys []string) cid.Cid {
+	cs := newIpldStore()
+	n := hamt.NewNode(cs)
+	for _, k := range keys {
+		v := cbg.CborInt(model[k])
+		if err := n.Set(ctx, k, &v); err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't set %q: %v", k, err))
+		}
+	}
+	if err := n.Flush(ctx); err != nil {
+		panic(fmt.Sprintf("Flush of model HAMT failed: %v", err))
+	}
+	c, err := cs.Put(ctx, n)
+	if err != nil {
+		panic(fmt.Sprintf("Put of model HAMT failed: %v", err))
+	}
+	return c
+}
+
+// checkHamtFind compares a single lookup against the model
+func checkHamtFind(ctx context.Context, n *hamt.Node, model map[string]int64, k string) {
+	var out cbg.CborInt
+	err := n.Find(ctx, k, &out)
+	want, ok := model[k]
+	switch {
+	case ok && err != nil:
+		panic(fmt.Sprintf("Find(%q) failed for present key: %v", k, err))
+	case !ok && err == nil:
+		panic(fmt.Sprintf("Find(%q) found a deleted or never set key: %d", k, out))
+	case !ok && err != hamt.ErrNotFound:
+		panic(fmt.Sprintf("Find(%q) of missing key returned unexpected error: %v", k, err))
+	case ok && int64(out) != want:
+		panic(fmt.Sprintf("Find(%q) = %d, want %d", k, out, want))
+	}
+}
+
+// Fuzzing go-hamt-ipld Set/Delete/Find/ForEach/Flush against a Go map
+func FuzzHamtOps(data []byte) int {
+	ctx := context.Background()
+	var ops []hamtOp
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&ops)
+	if len(ops) == 0 {
+		return 0
+	}
+
+	cs := newIpldStore()
+	n := hamt.NewNode(cs)
+	model := make(map[string]int64)
+
+	for _, op := range ops {
+		k := op.key()
+		switch int(op.Kind) % numHamtOps {
+		case hamtOpSet:
+			v := cbg.CborInt(op.Value)
+			if err := n.Set(ctx, k, &v); err != nil {
+				panic(fmt.Sprintf("Set(%q) failed: %v", k, err))
+			}
+			model[k] = op.Value
+		case hamtOpDelete:
+			err := n.Delete(ctx, k)
+			if _, ok := model[k]; ok && err != nil {
+				panic(fmt.Sprintf("Delete(%q) failed for present key: %v", k, err))
+			} else if !ok && err == nil {
+				panic(fmt.Sprintf("Delete(%q) succeeded for missing key", k))
+			}
+			delete(model, k)
+		case hamtOpFind:
+			// checked below after every op
+		case hamtOpForEach:
+			seen := make(map[string]int64)
+			err := n.ForEach(ctx, func(k string, val interface{}) error {
+				var v cbg.CborInt
+				if err := v.UnmarshalCBOR(bytes.NewReader(val.(*cbg.Deferred).Raw)); err != nil {
+					return err
+				}
+				if _, dup := seen[k]; dup {
+					panic(fmt.Sprintf("ForEach visited %q twice", k))
+				}
+				seen[k] = int64(v)
+				return nil
+			})
+			if err != nil {
+				panic(fmt.Sprintf("ForEach failed: %v", err))
+			}
+			if len(seen) != len(model) {
+				panic(fmt.Sprintf("ForEach visited %d keys, model holds %d", len(seen), len(model)))
+			}
+			for k, v := range seen {
+				if want, ok := model[k]; !ok || want != v {
+					panic(fmt.Sprintf("ForEach gave %q=%d, model has %d (present: %v)", k, v, want, ok))
+				}
+			}
+		case hamtOpFlush:
+			if err := n.Flush(ctx); err != nil {
+				panic(fmt.Sprintf("Flush failed: %v", err))
+			}
+			root, err := cs.Put(ctx, n)
+			if err != nil {
+				panic(fmt.Sprintf("Put of root failed: %v", err))
+			}
+
+			// The root only depends on the contents, not on the history
+			keys := make([]string, 0, len(model))
+			for k := range model {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if sorted := hamtRootFromModel(ctx, model, keys); !sorted.Equals(root) {
+				panic(fmt.Sprintf("Root %s differs from root %s of the same contents inserted in order", root, sorted))
+			}
+			for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+				keys[i], keys[j] = keys[j], keys[i]
+			}
+			if reversed := hamtRootFromModel(ctx, model, keys); !reversed.Equals(root) {
+				panic(fmt.Sprintf("Root %s differs from root %s of the same contents inserted in reverse", root, reversed))
+			}
+
+			// Carry on from the stored copy so loading gets exercised too
+			n, err = hamt.LoadNode(ctx, cs, root)
+			if err != nil {
+				panic(fmt.Sprintf("LoadNode of flushed root failed: %v", err))
+			}
+		}
+		checkHamtFind(ctx, n, model, k)
+	}
+	return 1
+}
@@ -0,0 +1,193 @@
+// Stateful fuzzing of init actor Exec and address resolution
+// Actors are created with fuzzed code CIDs from fuzzed callers in the specs-actors mock
+// runtime, the address map is checked against what Exec returned
+
+package fuzz
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	init_ "github.com/filecoin-project/specs-actors/actors/builtin/init"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Code CIDs Exec is asked for, a fuzzed CID stands in for anything else
+var initCodes = []cid.Cid{
+	builtin.AccountActorCodeID,
+	builtin.InitActorCodeID,
+	builtin.CronActorCodeID,
+	builtin.StoragePowerActorCodeID,
+	builtin.StorageMinerActorCodeID,
+	builtin.StorageMarketActorCodeID,
+	builtin.PaymentChannelActorCodeID,
+	builtin.MultisigActorCodeID,
+	builtin.RewardActorCodeID,
+	builtin.VerifiedRegistryActorCodeID,
+	builtin.SystemActorCodeID,
+}
+
+// One Exec call
+type initExec struct {
+	Caller uint8
+	// Index into initCodes, the value after the last one for UnknownCode
+	Code        uint8
+	UnknownCode []byte
+	Params      []byte
+	Value       uint32
+	// The new actor's constructor aborts
+	CtorFails bool
+}
+
+func newInitState() cbg.CBORUnmarshaler {
+	return new(init_.State)
+}
+
+// canExec is who may create what, mirrored from the init actor's rules
+func canExec(caller, code cid.Cid) bool {
+	switch {
+	case code.Equals(builtin.StorageMinerActorCodeID):
+		return caller.Equals(builtin.StoragePowerActorCodeID)
+	case code.Equals(builtin.PaymentChannelActorCodeID), code.Equals(builtin.MultisigActorCodeID):
+		return true
+	}
+	return false
+}
+
+// robustAddress is the address the runtime hands out for the n-th new actor
+func robustAddress(n uint64) goaddr.Address {
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], n)
+	a, err := goaddr.NewActorAddress(seed[:])
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+	}
+	return a
+}
+
+// checkAddressMap checks the map is one to one, with IDs below NextID, and that every
+// actor created resolves to the ID Exec returned
+func checkAddressMap(rt *mockrt.Runtime, st *init_.State, created map[goaddr.Address]goaddr.Address) {
+	store := adt.AsStore(rt)
+	m, err := adt.AsMap(store, st.AddressMap)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load address map: %v", err))
+	}
+	ids := make(map[int64]goaddr.Address)
+	var id cbg.CborInt
+	err = m.ForEach(&id, func(k string) error {
+		a, err := goaddr.NewFromBytes([]byte(k))
+		if err != nil {
+			return err
+		}
+		if prev, ok := ids[int64(id)]; ok {
+			panic(fmt.Sprintf("%s and %s both map to ID %d", prev, a, id))
+		}
+		if int64(id) >= int64(st.NextID) {
+			panic(fmt.Sprintf("%s maps to ID %d, next ID is %d", a, id, st.NextID))
+		}
+		ids[int64(id)] = a
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read address map: %v", err))
+	}
+	if len(ids) != len(created) {
+		panic(fmt.Sprintf("address map has %d entries, %d actors were created", len(ids), len(created)))
+	}
+
+	for robust, idAddr := range created {
+		resolved, found, err := st.ResolveAddress(store, robust)
+		if err != nil {
+			panic(fmt.Sprintf("Couldn't resolve %s: %v", robust, err))
+		}
+		if !found || resolved != idAddr {
+			panic(fmt.Sprintf("%s resolves to %s (found %v), Exec returned %s", robust, resolved, found, idAddr))
+		}
+		resolved, found, err = st.ResolveAddress(store, idAddr)
+		if err != nil || !found || resolved != idAddr {
+			panic(fmt.Sprintf("ID address %s resolves to %s (found %v, err %v)", idAddr, resolved, found, err))
+		}
+	}
+}
+
+// Fuzzing init actor Exec, only known code CIDs from allowed callers get actors, and
+// every actor created gets an ID of its own that its robust address resolves to
+func FuzzInitExec(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var execs []initExec
+	f.Fuzz(&execs)
+	if len(execs) > maxScenarioSteps {
+		execs = execs[:maxScenarioSteps]
+	}
+
+	rt := mockrt.NewRuntime(builtin.InitActorAddr, 0, big.Zero())
+	actor := init_.Actor{}
+	if !construct(rt, actor.Exports(), systemCaller, expectAddr(builtin.SystemActorAddr), &init_.ConstructorParams{NetworkName: "fuzz"}) {
+		return 0
+	}
+
+	var st init_.State
+	created := make(map[goaddr.Address]goaddr.Address)
+	var nextRobust uint64
+	for _, e := range execs {
+		rt.GetState(&st)
+		caller := dispatchCallers[int(e.Caller)%len(dispatchCallers)]
+		code := cidOf(e.UnknownCode)
+		if i := int(e.Code) % (len(initCodes) + 1); i < len(initCodes) {
+			code = initCodes[i]
+		}
+		value := abi.NewTokenAmount(int64(e.Value))
+		ctorExit := exitcode.Ok
+		if e.CtorFails {
+			ctorExit = exitcode.ErrIllegalArgument
+		}
+
+		robust := robustAddress(nextRobust)
+		idAddr := mockrt.IDAddress(uint64(st.NextID))
+		rt.SetCaller(caller.addr, caller.code)
+		rt.SetReceived(value)
+		rt.SetBalance(value)
+		rt.ExpectValidateCallerAny()
+		rt.SetNewActorAddress(robust)
+		rt.ExpectCreateActor(code, idAddr)
+		rt.ExpectSend(idAddr, builtin.MethodConstructor, vmr.CBORBytes(e.Params), value, nil, ctorExit)
+
+		res := mockrt.InvokeReverting(rt, newInitState, actor.Exec, &init_.ExecParams{CodeCID: code, ConstructorParams: e.Params})
+		if res.MockFailure {
+			return 0
+		}
+		if !res.Aborted {
+			if !canExec(caller.code, code) {
+				panic(fmt.Sprintf("Exec created an actor with code %s for a %s caller", code, caller.code))
+			}
+			if ctorExit != exitcode.Ok {
+				panic(fmt.Sprintf("Exec succeeded though the constructor exited with %d", ctorExit))
+			}
+			ret := res.Ret.(*init_.ExecReturn)
+			if ret.IDAddress != idAddr || ret.RobustAddress != robust {
+				panic(fmt.Sprintf("Exec returned %s/%s, expected %s/%s", ret.IDAddress, ret.RobustAddress, idAddr, robust))
+			}
+			created[robust] = idAddr
+			nextRobust++
+		}
+
+		var after init_.State
+		rt.GetState(&after)
+		if !res.Aborted && after.NextID != st.NextID+1 {
+			panic(fmt.Sprintf("next ID went from %d to %d creating one actor", st.NextID, after.NextID))
+		}
+		checkAddressMap(rt, &after, created)
+	}
+	return 1
+}
@@ -0,0 +1,224 @@
+// Fuzzing HAMT and AMT trees built from adversarial on-disk nodes
+// Decoding a node alone doesn't exercise the invariants the tree code relies on
+// (bitfield popcount matching the pointer count, bucket sizes, bitmap matching the
+// value count, height consistency), so the nodes are planted in a blockstore and
+// the tree is driven through its public API instead
+// Nothing here guards against hangs, a cyclic or runaway tree is only caught by the
+// fuzzer's -timeout. The operations run on the caller's goroutine so replay can
+// recover their panics
+
+package fuzz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	amtipld "github.com/filecoin-project/go-amt-ipld"
+	gfuzz "github.com/google/gofuzz"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	hamt "github.com/ipfs/go-hamt-ipld"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Operations run against a planted tree
+type plantedOps struct {
+	Keys     []string
+	Indexes  []uint64
+	SetValue int64
+}
+
+// Raw mode input, a single root node
+type plantedRawInput struct {
+	Root []byte
+	Ops  plantedOps
+}
+
+// plantRaw stores raw as a dag-cbor block, whether or not it decodes, and returns its CID
+func plantRaw(bs blockstore.Blockstore, raw []byte) cid.Cid {
+	c, err := cid.NewPrefixV1(cid.DagCBOR, mh.SHA2_256).Sum(raw)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create CID: %v", err))
+	}
+	blk, err := blocks.NewBlockWithCid(raw, c)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create block: %v", err))
+	}
+	if err := bs.Put(blk); err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't put block: %v", err))
+	}
+	return c
+}
+
+// runHamtOps drives the public HAMT API on a loaded root, errors are fine, panics and hangs aren't
+func runHamtOps(ctx context.Context, n *hamt.Node, ops plantedOps) {
+	_ = n.ForEach(ctx, func(k string, val interface{}) error { return nil })
+	for _, k := range ops.Keys {
+		var out cbg.CborInt
+		_ = n.Find(ctx, k, &out)
+		v := cbg.CborInt(ops.SetValue)
+		_ = n.Set(ctx, k, &v)
+		_ = n.Delete(ctx, k)
+	}
+	_ = n.Flush(ctx)
+}
+
+// runAmtOps drives the public AMT API on a loaded root, errors are fine, panics and hangs aren't
+func runAmtOps(ctx context.Context, r *amtipld.Root, ops plantedOps) {
+	_ = r.ForEach(ctx, func(i uint64, val *cbg.Deferred) error { return nil })
+	for _, i := range ops.Indexes {
+		var out cbg.CborInt
+		_ = r.Get(ctx, i, &out)
+		v := cbg.CborInt(ops.SetValue)
+		_ = r.Set(ctx, i, &v)
+		_ = r.Delete(ctx, i)
+	}
+	_, _ = r.Flush(ctx)
+}
+
+func newPlantedStore() (blockstore.Blockstore, cbor.IpldStore) {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	return bs, cbor.NewCborStore(bs)
+}
+
+// Fuzzing the HAMT API on a root node planted from raw bytes
+func FuzzHamtPlantedRaw(data []byte) int {
+	ctx := context.Background()
+	var in plantedRawInput
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&in)
+
+	bs, cs := newPlantedStore()
+	root := plantRaw(bs, in.Root)
+	n, err := hamt.LoadNode(ctx, cs, root)
+	if err != nil {
+		return 0
+	}
+	runHamtOps(ctx, n, in.Ops)
+	return 1
+}
+
+// Fuzzing the AMT API on a root planted from raw bytes
+func FuzzAmtPlantedRaw(data []byte) int {
+	ctx := context.Background()
+	var in plantedRawInput
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&in)
+
+	bs, cs := newPlantedStore()
+	root := plantRaw(bs, in.Root)
+	r, err := amtipld.LoadAMT(ctx, cs, root)
+	if err != nil {
+		return 0
+	}
+	runAmtOps(ctx, r, in.Ops)
+	return 1
+}
+
+// Structured mode, nodes are generated bottom up so links can point at earlier
+// nodes, which random bytes would practically never do
+const maxPlantedNodes = 8
+
+// One link in this many is left undefined
+const plantedUndefLinkOdds = 16
+
+// newPlantedFuzzer fills the bitfields, which gofuzz can't reach, and points every
+// link at one of the nodes planted so far
+func newPlantedFuzzer(data []byte, planted *[]cid.Cid) *gfuzz.Fuzzer {
+	return gfuzz.NewFromGoFuzz(data).NilChance(0.2).NumElements(0, 8).Funcs(
+		func(b *big.Int, c gfuzz.Continue) {
+			b.SetUint64(c.Uint64())
+		},
+		func(l *cid.Cid, c gfuzz.Continue) {
+			// an undefined link fails to encode and the input is thrown away, keep those rare
+			if len(*planted) == 0 || c.Intn(plantedUndefLinkOdds) == 0 {
+				*l = cid.Undef
+				return
+			}
+			*l = (*planted)[c.Intn(len(*planted))]
+		},
+		func(d *cbg.Deferred, c gfuzz.Continue) {
+			// a CBOR int, or garbage
+			if c.RandBool() {
+				c.Fuzz(&d.Raw)
+				return
+			}
+			v := cbg.CborInt(c.Int63())
+			buf := new(bytes.Buffer)
+			_ = v.MarshalCBOR(buf)
+			d.Raw = buf.Bytes()
+		},
+	)
+}
+
+// Fuzzing the HAMT API on a tree of generated nodes with consistent links
+func FuzzHamtPlantedStructured(data []byte) int {
+	ctx := context.Background()
+	_, cs := newPlantedStore()
+	var planted []cid.Cid
+	f := newPlantedFuzzer(data, &planted)
+
+	var count uint8
+	f.Fuzz(&count)
+	for i := 0; i < int(count)%maxPlantedNodes+1; i++ {
+		var node hamt.Node
+		f.Fuzz(&node)
+		c, err := cs.Put(ctx, &node)
+		if err != nil {
+			return 0
+		}
+		planted = append(planted, c)
+	}
+
+	var ops plantedOps
+	f.Fuzz(&ops)
+	n, err := hamt.LoadNode(ctx, cs, planted[len(planted)-1])
+	if err != nil {
+		return 0
+	}
+	runHamtOps(ctx, n, ops)
+	return 1
+}
+
+// Fuzzing the AMT API on a tree of generated nodes with consistent links
+func FuzzAmtPlantedStructured(data []byte) int {
+	ctx := context.Background()
+	_, cs := newPlantedStore()
+	var planted []cid.Cid
+	f := newPlantedFuzzer(data, &planted)
+
+	var count uint8
+	f.Fuzz(&count)
+	for i := 0; i < int(count)%maxPlantedNodes+1; i++ {
+		var node amtipld.Node
+		f.Fuzz(&node)
+		c, err := cs.Put(ctx, &node)
+		if err != nil {
+			return 0
+		}
+		planted = append(planted, c)
+	}
+
+	var root amtipld.Root
+	f.Fuzz(&root)
+	// Keep the height within reach of the planted depth most of the time
+	root.Height %= maxHeight + 2
+	c, err := cs.Put(ctx, &root)
+	if err != nil {
+		return 0
+	}
+
+	var ops plantedOps
+	f.Fuzz(&ops)
+	r, err := amtipld.LoadAMT(ctx, cs, c)
+	if err != nil {
+		return 0
+	}
+	runAmtOps(ctx, r, ops)
+	return 1
+}
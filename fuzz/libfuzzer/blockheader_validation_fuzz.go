@@ -0,0 +1,197 @@
+// Semantic fuzzing of BlockHeader validation
+// FuzzBlockHeader only checks serialization, these harnesses feed mutated headers
+// into the Syncer's block validation on top of a locally generated chain
+// Mutated headers are signed again with the miner's key, so validation gets past the
+// signature check to the field that was changed
+
+package libfuzzer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain"
+	"github.com/filecoin-project/lotus/chain/beacon"
+	"github.com/filecoin-project/lotus/chain/gen"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	mock "github.com/filecoin-project/sector-storage/mock"
+	gfuzz "github.com/google/gofuzz"
+)
+
+// Number of tipsets mined on top of genesis to take valid blocks from
+const validationChainLength = 4
+
+// Created once, generating the chain is far too slow to do per execution
+var validationEnv struct {
+	once   sync.Once
+	syncer *chain.Syncer
+	blocks []*types.FullBlock
+	wallet *wallet.Wallet
+	// The key each block was signed with
+	signers []goaddr.Address
+}
+
+// setupValidationEnv mines a short chain with an in-memory store and a mock beacon
+// and builds a Syncer over the same state manager
+func setupValidationEnv() {
+	cg, err := gen.NewGenerator()
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create chain generator: %v", err))
+	}
+	for i := 0; i < validationChainLength; i++ {
+		mts, err := cg.NextTipSet()
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't mine tipset: %v", err))
+		}
+		validationEnv.blocks = append(validationEnv.blocks, mts.TipSet.Blocks...)
+	}
+
+	// The generator signs with the miners' worker keys, find which one signed each block
+	validationEnv.wallet = cg.Wallet()
+	keys, err := validationEnv.wallet.ListAddrs()
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't list keys: %v", err))
+	}
+	for _, b := range validationEnv.blocks {
+		sb, err := b.Header.SigningBytes()
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't get signing bytes: %v", err))
+		}
+		signer := goaddr.Undef
+		for _, k := range keys {
+			if sigs.Verify(b.Header.BlockSig, k, sb) == nil {
+				signer = k
+			}
+		}
+		if signer == goaddr.Undef {
+			panic("Bug in harness, no key in the wallet signed a generated block")
+		}
+		validationEnv.signers = append(validationEnv.signers, signer)
+	}
+
+	mb := beacon.NewMockBeacon(build.BlockDelay * time.Second)
+	syncer, err := chain.NewSyncer(cg.StateManager(), nil, nil, "", mb, mock.MockVerifier)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create syncer: %v", err))
+	}
+	validationEnv.syncer = syncer
+}
+
+// Header fields mutated by FuzzBlockHeaderValidation
+const (
+	mutateTicket = iota
+	mutateElectionProof
+	mutateBeaconEntries
+	mutateParents
+	mutateParentWeight
+	mutateHeight
+	mutateBLSAggregate
+	mutateTimestamp
+	mutateMiner
+	mutateWinPoStProof
+	numMutations
+)
+
+// mutateHeader overwrites a single fuzzer-chosen field of h and reports whether
+// validation has to reject the result when it changed anything
+func mutateHeader(f *gfuzz.Fuzzer, h *types.BlockHeader) bool {
+	var choice uint8
+	f.Fuzz(&choice)
+	switch int(choice) % numMutations {
+	case mutateTicket:
+		f.Fuzz(&h.Ticket)
+	case mutateElectionProof:
+		f.Fuzz(&h.ElectionProof)
+	case mutateBeaconEntries:
+		f.Fuzz(&h.BeaconEntries)
+	case mutateParents:
+		// Duplicate a real parent or put in fuzzed ones
+		var dup bool
+		f.Fuzz(&dup)
+		if dup && len(h.Parents) > 0 {
+			h.Parents = append(h.Parents, h.Parents[0])
+		} else {
+			f.Fuzz(&h.Parents)
+		}
+	case mutateParentWeight:
+		// gofuzz can't fill big.Int as its fields are unexported
+		var w uint64
+		f.Fuzz(&w)
+		h.ParentWeight = types.NewInt(w)
+	case mutateHeight:
+		f.Fuzz(&h.Height)
+	case mutateBLSAggregate:
+		f.Fuzz(&h.BLSAggregate)
+	case mutateTimestamp:
+		// Small offsets around the real timestamp to hit the bounds checks
+		var delta int8
+		f.Fuzz(&delta)
+		h.Timestamp = uint64(int64(h.Timestamp) + int64(delta))
+	case mutateMiner:
+		f.Fuzz(&h.Miner)
+	case mutateWinPoStProof:
+		f.Fuzz(&h.WinPoStProof)
+		// the mock verifier accepts any proof
+		return false
+	}
+	return true
+}
+
+// Fuzzing Syncer.ValidateBlock with a single field of a valid header mutated
+// Malformed headers must be rejected with an error rather than a panic
+func FuzzBlockHeaderValidation(data []byte) int {
+	validationEnv.once.Do(setupValidationEnv)
+
+	f := newStructuredFuzzer(data)
+	var idx uint8
+	f.Fuzz(&idx)
+	i := int(idx) % len(validationEnv.blocks)
+	orig := validationEnv.blocks[i]
+
+	h := *orig.Header
+	mustReject := mutateHeader(f, &h)
+	sb, err := h.SigningBytes()
+	if err != nil {
+		return 0
+	}
+	h.BlockSig, err = validationEnv.wallet.Sign(context.TODO(), validationEnv.signers[i], sb)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't sign block: %v", err))
+	}
+
+	// Go through the wire encoding, as a header received from the network would
+	encoded, err := h.Serialize()
+	if err != nil {
+		return 0
+	}
+	header, err := types.DecodeBlock(encoded)
+	if err != nil {
+		return 0
+	}
+
+	fb := &types.FullBlock{
+		Header:        header,
+		BlsMessages:   orig.BlsMessages,
+		SecpkMessages: orig.SecpkMessages,
+	}
+	err = validationEnv.syncer.ValidateBlock(context.TODO(), fb)
+	if header.Cid() == orig.Header.Cid() {
+		// Mutation was a no-op, the original block has to stay valid
+		if err != nil {
+			panic(fmt.Sprintf("Valid block rejected after no-op mutation: %v", err))
+		}
+		return 0
+	}
+	if err == nil && mustReject {
+		fmt.Printf("original: %#v\n", orig.Header)
+		fmt.Printf("mutated: %#v\n", header)
+		panic("Mutated BlockHeader passed validation")
+	}
+	return 1
+}
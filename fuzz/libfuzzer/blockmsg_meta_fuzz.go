@@ -0,0 +1,178 @@
+// Semantic fuzzing of BlockMsg and MsgMeta
+// FuzzBlockMsg only checks bytes, these harnesses build the message roots the way
+// the miner does and check the receiving side agrees, and notices tampering
+
+package libfuzzer
+
+import (
+	"context"
+	"fmt"
+
+	amtipld "github.com/filecoin-project/go-amt-ipld"
+	"github.com/filecoin-project/lotus/chain/types"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// computeMsgMeta builds the MsgMeta root for the given message CIDs
+// the way the miner does, from lotus/chain/gen/mining.go
+func computeMsgMeta(ctx context.Context, bls, secpk []cid.Cid) (cid.Cid, error) {
+	cst := cbor.NewCborStore(blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())))
+	toIfArr := func(cids []cid.Cid) []cbg.CBORMarshaler {
+		out := make([]cbg.CBORMarshaler, len(cids))
+		for i := range cids {
+			c := cbg.CborCid(cids[i])
+			out[i] = &c
+		}
+		return out
+	}
+	blsRoot, err := amtipld.FromArray(ctx, cst, toIfArr(bls))
+	if err != nil {
+		return cid.Undef, err
+	}
+	secpkRoot, err := amtipld.FromArray(ctx, cst, toIfArr(secpk))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cst.Put(ctx, &types.MsgMeta{
+		BlsMessages:   blsRoot,
+		SecpkMessages: secpkRoot,
+	})
+}
+
+func blsCids(msgs []*types.Message) []cid.Cid {
+	out := make([]cid.Cid, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Cid()
+	}
+	return out
+}
+
+func secpkCids(msgs []*types.SignedMessage) []cid.Cid {
+	out := make([]cid.Cid, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Cid()
+	}
+	return out
+}
+
+func equalCids(a, b []cid.Cid) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equals(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Mutations applied to the message lists after the roots were computed
+const (
+	msgMetaMutateNone = iota
+	msgMetaMutateDropBls
+	msgMetaMutateDropSecpk
+	msgMetaMutateDupBls
+	msgMetaMutateDupSecpk
+	msgMetaMutateSwapBls
+	msgMetaMutateSwapSecpk
+	msgMetaMutateMoveToBls
+	numMsgMetaMutations
+)
+
+// Fuzzing the MsgMeta check on the receiving side against the roots the miner computed
+// The untouched lists have to pass and any change to them has to be rejected
+func FuzzBlockMsgMeta(data []byte) int {
+	validationEnv.once.Do(setupValidationEnv)
+	ctx := context.TODO()
+
+	f := newStructuredFuzzer(data)
+	var idx, mutation uint8
+	f.Fuzz(&idx)
+	f.Fuzz(&mutation)
+	var bls []*types.Message
+	var secpk []*types.SignedMessage
+	f.Fuzz(&bls)
+	f.Fuzz(&secpk)
+
+	mmcid, err := computeMsgMeta(ctx, blsCids(bls), secpkCids(secpk))
+	if err != nil {
+		return 0
+	}
+	h := *validationEnv.blocks[int(idx)%len(validationEnv.blocks)].Header
+	h.Messages = mmcid
+
+	// The BlockMsg goes over the wire, the messages themselves are fetched by CID
+	bm := &types.BlockMsg{
+		Header:        &h,
+		BlsMessages:   blsCids(bls),
+		SecpkMessages: secpkCids(secpk),
+	}
+	raw, err := bm.Serialize()
+	if err != nil {
+		return 0
+	}
+	received, err := types.DecodeBlockMsg(raw)
+	if err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	if !equalCids(received.BlsMessages, bm.BlsMessages) || !equalCids(received.SecpkMessages, bm.SecpkMessages) {
+		panic("BlockMsg message CIDs changed over the wire")
+	}
+
+	switch int(mutation) % numMsgMetaMutations {
+	case msgMetaMutateNone:
+	case msgMetaMutateDropBls:
+		if len(bls) > 0 {
+			bls = bls[1:]
+		}
+	case msgMetaMutateDropSecpk:
+		if len(secpk) > 0 {
+			secpk = secpk[1:]
+		}
+	case msgMetaMutateDupBls:
+		if len(bls) > 0 {
+			bls = append(bls, bls[0])
+		}
+	case msgMetaMutateDupSecpk:
+		if len(secpk) > 0 {
+			secpk = append(secpk, secpk[0])
+		}
+	case msgMetaMutateSwapBls:
+		if len(bls) > 1 {
+			bls[0], bls[1] = bls[1], bls[0]
+		}
+	case msgMetaMutateSwapSecpk:
+		if len(secpk) > 1 {
+			secpk[0], secpk[1] = secpk[1], secpk[0]
+		}
+	case msgMetaMutateMoveToBls:
+		// A secp message stripped of its signature and listed as BLS
+		if len(secpk) > 0 {
+			bls = append(bls, &secpk[0].Message)
+			secpk = secpk[1:]
+		}
+	}
+	unchanged := equalCids(blsCids(bls), received.BlsMessages) && equalCids(secpkCids(secpk), received.SecpkMessages)
+
+	fb := &types.FullBlock{
+		Header:        received.Header,
+		BlsMessages:   bls,
+		SecpkMessages: secpk,
+	}
+	err = validationEnv.syncer.ValidateMsgMeta(fb)
+	if unchanged && err != nil {
+		panic(fmt.Sprintf("Message roots computed like the miner does were rejected: %v", err))
+	}
+	if !unchanged && err == nil {
+		fmt.Printf("sent bls: %v secpk: %v\n", received.BlsMessages, received.SecpkMessages)
+		fmt.Printf("got bls: %v secpk: %v\n", blsCids(bls), secpkCids(secpk))
+		panic("Mutated message lists match the MsgMeta in the header")
+	}
+	return 1
+}
@@ -80,7 +80,7 @@ var cborTypeMap = map[string]reflect.Type{
 	//TODO DataTransferMessage is an interface not a struct type, need to expose
 	//the hidden `transferMessage` type
 	//"DataTransferMessage":     reflect.TypeOf((*message.DataTransferMessage)(nil)).Elem(),
-	//TODO remove? the following types don't implement CBORer
+	//NOTE the following types don't implement CBORer, they are fuzzed as JSON in json_type_fuzz.go
 	//"SortedPublicSectorInfo":  reflect.TypeOf((*ffi.SortedPublicSectorInfo)(nil)).Elem(),
 	//"SortedPrivateSectorInfo": reflect.TypeOf((*ffi.SortedPrivateSectorInfo)(nil)).Elem(),
 	// spec-actor "*Params"
@@ -0,0 +1,219 @@
+// Cross-encoding consistency between CBOR and JSON
+// Many registry types are sent over both libp2p (CBOR) and JSON-RPC (JSON),
+// a field dropped or transformed by only one of them would go unnoticed by the
+// single encoding round-trips
+
+package libfuzzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	dfuzzutil "github.com/dvyukov/go-fuzz-corpus/fuzz"
+)
+
+// PtrToType(typ) should implement CBORer
+func crossEncodingFuzzUtil(data []byte, typ reflect.Type) int {
+	f := newStructuredFuzzer(data)
+	val := reflect.New(typ)
+	valIface := val.Interface().(CBORer)
+	f.Fuzz(valIface)
+
+	buf := new(bytes.Buffer)
+	if err := valIface.MarshalCBOR(buf); err != nil {
+		return 0
+	}
+	rawCBOR := buf.Bytes()
+	rawJSON, err := json.Marshal(valIface)
+	if err != nil {
+		return 0
+	}
+
+	fromCBOR := reflect.New(typ).Interface().(CBORer)
+	if err := fromCBOR.UnmarshalCBOR(bytes.NewReader(rawCBOR)); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made.\nErr: %v", err))
+	}
+	fromJSON := reflect.New(typ).Interface().(CBORer)
+	if err := json.Unmarshal(rawJSON, fromJSON); err != nil {
+		fmt.Printf("Generated struct: %#v\n", valIface)
+		fmt.Printf("Initial serialized value: %s\n", rawJSON)
+		panic(fmt.Sprintf("should be able to unmarshal something we made.\nErr: %v", err))
+	}
+
+	// CBOR is canonical, so a value that went through JSON has to encode to the same bytes
+	buf1 := new(bytes.Buffer)
+	if err := fromJSON.MarshalCBOR(buf1); err != nil {
+		panic(fmt.Sprintf("should be able to marshal a value decoded from JSON.\nErr: %v", err))
+	}
+	if !bytes.Equal(rawCBOR, buf1.Bytes()) {
+		fmt.Printf("generated: %#v\n", valIface)
+		fmt.Printf("from json: %#v\n", fromJSON)
+		panic("JSON dropped or transformed a field that CBOR keeps")
+	}
+
+	// And the other way around, a value that went through CBOR has to give the same JSON
+	rawJSON1, err := json.Marshal(fromCBOR)
+	if err != nil {
+		panic(fmt.Sprintf("should be able to marshal a value decoded from CBOR.\nErr: %v", err))
+	}
+	if !jsonEquivalent(rawJSON, rawJSON1) {
+		fmt.Printf("json from generated: %s\n", rawJSON)
+		fmt.Printf("json from cbor: %s\n", rawJSON1)
+		panic("CBOR dropped or transformed a field that JSON keeps")
+	}
+	return 1
+}
+
+// jsonEquivalent compares two JSON documents, treating null and [] the same.
+// CBOR can't tell a nil array from an empty one, so every empty array comes back
+// as null, that one difference is expected and anything else is reported
+func jsonEquivalent(a, b []byte) bool {
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		panic(fmt.Sprintf("Bug in harness, invalid JSON: %v", err))
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		panic(fmt.Sprintf("Bug in harness, invalid JSON: %v", err))
+	}
+	return dfuzzutil.DeepEqual(normalizeEmpty(va), normalizeEmpty(vb))
+}
+
+// normalizeEmpty replaces empty arrays with nil, recursively
+func normalizeEmpty(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		if len(t) == 0 {
+			return nil
+		}
+		for i := range t {
+			t[i] = normalizeEmpty(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = normalizeEmpty(t[k])
+		}
+	}
+	return v
+}
+
+// Fuzzing VoucherInfo CBOR and JSON encodings of the same generated struct
+func FuzzVoucherInfoCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["VoucherInfo"])
+}
+
+// Fuzzing ChannelInfo CBOR and JSON encodings of the same generated struct
+func FuzzChannelInfoCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["ChannelInfo"])
+}
+
+// Fuzzing PaymentInfo CBOR and JSON encodings of the same generated struct
+func FuzzPaymentInfoCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["PaymentInfo"])
+}
+
+// Fuzzing SealedRef CBOR and JSON encodings of the same generated struct
+func FuzzSealedRefCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["SealedRef"])
+}
+
+// Fuzzing SealedRefs CBOR and JSON encodings of the same generated struct
+func FuzzSealedRefsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["SealedRefs"])
+}
+
+// Fuzzing SealTicket CBOR and JSON encodings of the same generated struct
+func FuzzSealTicketCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["SealTicket"])
+}
+
+// Fuzzing SealSeed CBOR and JSON encodings of the same generated struct
+func FuzzSealSeedCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["SealSeed"])
+}
+
+// Fuzzing Actor CBOR and JSON encodings of the same generated struct
+func FuzzActorCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["Actor"])
+}
+
+// Fuzzing SignedMessage CBOR and JSON encodings of the same generated struct
+func FuzzSignedMessageCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["SignedMessage"])
+}
+
+// Fuzzing MsgMeta CBOR and JSON encodings of the same generated struct
+func FuzzMsgMetaCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["MsgMeta"])
+}
+
+// Fuzzing MessageReceipt CBOR and JSON encodings of the same generated struct
+func FuzzMessageReceiptCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["MessageReceipt"])
+}
+
+// Fuzzing DealProposal CBOR and JSON encodings of the same generated struct
+func FuzzDealProposalCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["DealProposal"])
+}
+
+// Fuzzing Address CBOR and JSON encodings of the same generated struct
+func FuzzAddressCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["Address"])
+}
+
+// Fuzzing PublishStorageDealsParams CBOR and JSON encodings of the same generated struct
+func FuzzPublishStorageDealsParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["PublishStorageDealsParams"])
+}
+
+// Fuzzing SubmitWindowedPoStParams CBOR and JSON encodings of the same generated struct
+func FuzzSubmitWindowedPoStParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["SubmitWindowedPoStParams"])
+}
+
+// Fuzzing TerminateSectorsParams CBOR and JSON encodings of the same generated struct
+func FuzzTerminateSectorsParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["TerminateSectorsParams"])
+}
+
+// Fuzzing ExtendSectorExpirationParams CBOR and JSON encodings of the same generated struct
+func FuzzExtendSectorExpirationParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["ExtendSectorExpirationParams"])
+}
+
+// Fuzzing DeclareFaultsParams CBOR and JSON encodings of the same generated struct
+func FuzzDeclareFaultsParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["DeclareFaultsParams"])
+}
+
+// Fuzzing DeclareFaultsRecoveredParams CBOR and JSON encodings of the same generated struct
+func FuzzDeclareFaultsRecoveredParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["DeclareFaultsRecoveredParams"])
+}
+
+// Fuzzing CreateMinerParams CBOR and JSON encodings of the same generated struct
+func FuzzCreateMinerParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["CreateMinerParams"])
+}
+
+// Fuzzing ExecParams CBOR and JSON encodings of the same generated struct
+func FuzzExecParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["ExecParams"])
+}
+
+// Fuzzing ProposeParams CBOR and JSON encodings of the same generated struct
+func FuzzProposeParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["ProposeParams"])
+}
+
+// Fuzzing UpdateChannelStateParams CBOR and JSON encodings of the same generated struct
+func FuzzUpdateChannelStateParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["UpdateChannelStateParams"])
+}
+
+// Fuzzing AwardBlockRewardParams CBOR and JSON encodings of the same generated struct
+func FuzzAwardBlockRewardParamsCrossEncoding(data []byte) int {
+	return crossEncodingFuzzUtil(data, cborTypeMap["AwardBlockRewardParams"])
+}
@@ -0,0 +1,784 @@
+// JSON unmarshal/marshal harnesses, the counterpart of the CBOR ones for types
+// sent over JSON rather than CBOR
+
+package libfuzzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	dfuzzutil "github.com/dvyukov/go-fuzz-corpus/fuzz"
+	ffi "github.com/filecoin-project/filecoin-ffi"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// NOTE: most api types don't implement MarshalJSON themselves, their fields do,
+// so the harnesses go through encoding/json rather than an interface like CBORer
+
+// To save making the reflection type every time the harness is called
+var jsonTypeMap = map[string]reflect.Type{
+	"TipSetKey":          reflect.TypeOf((*types.TipSetKey)(nil)).Elem(),
+	"BigInt":             reflect.TypeOf((*types.BigInt)(nil)).Elem(),
+	"Address":            reflect.TypeOf((*goaddr.Address)(nil)).Elem(),
+	"Cid":                reflect.TypeOf((*cid.Cid)(nil)).Elem(),
+	"MinerInfo":          reflect.TypeOf((*miner.MinerInfo)(nil)).Elem(),
+	"MsgLookup":          reflect.TypeOf((*api.MsgLookup)(nil)).Elem(),
+	"MinerPower":         reflect.TypeOf((*api.MinerPower)(nil)).Elem(),
+	"MinerSectors":       reflect.TypeOf((*api.MinerSectors)(nil)).Elem(),
+	"BlockMessages":      reflect.TypeOf((*api.BlockMessages)(nil)).Elem(),
+	"Message":            reflect.TypeOf((*api.Message)(nil)).Elem(),
+	"ActorState":         reflect.TypeOf((*api.ActorState)(nil)).Elem(),
+	"MarketBalance":      reflect.TypeOf((*api.MarketBalance)(nil)).Elem(),
+	"MarketDeal":         reflect.TypeOf((*api.MarketDeal)(nil)).Elem(),
+	"DealInfo":           reflect.TypeOf((*api.DealInfo)(nil)).Elem(),
+	"StartDealParams":    reflect.TypeOf((*api.StartDealParams)(nil)).Elem(),
+	"QueryOffer":         reflect.TypeOf((*api.QueryOffer)(nil)).Elem(),
+	"RetrievalOrder":     reflect.TypeOf((*api.RetrievalOrder)(nil)).Elem(),
+	"FileRef":            reflect.TypeOf((*api.FileRef)(nil)).Elem(),
+	"PCHInfo":            reflect.TypeOf((*api.PCHInfo)(nil)).Elem(),
+	"PaymentInfo":        reflect.TypeOf((*api.PaymentInfo)(nil)).Elem(),
+	"VoucherSpec":        reflect.TypeOf((*api.VoucherSpec)(nil)).Elem(),
+	"SealedRef":          reflect.TypeOf((*api.SealedRef)(nil)).Elem(),
+	"SealedRefs":         reflect.TypeOf((*api.SealedRefs)(nil)).Elem(),
+	"SealTicket":         reflect.TypeOf((*api.SealTicket)(nil)).Elem(),
+	"SealSeed":           reflect.TypeOf((*api.SealSeed)(nil)).Elem(),
+	"SectorInfo":         reflect.TypeOf((*api.SectorInfo)(nil)).Elem(),
+	"SyncState":          reflect.TypeOf((*api.SyncState)(nil)).Elem(),
+	"ActiveSync":         reflect.TypeOf((*api.ActiveSync)(nil)).Elem(),
+	"MpoolUpdate":        reflect.TypeOf((*api.MpoolUpdate)(nil)).Elem(),
+	"MethodCall":         reflect.TypeOf((*api.MethodCall)(nil)).Elem(),
+	"InvocResult":        reflect.TypeOf((*api.InvocResult)(nil)).Elem(),
+	"ComputeStateOutput": reflect.TypeOf((*api.ComputeStateOutput)(nil)).Elem(),
+	"Version":            reflect.TypeOf((*api.Version)(nil)).Elem(),
+}
+
+// Returns the decoded value for additional type specific checks, nil if the input was rejected
+func jsonFuzzUtilRaw(data []byte, typ reflect.Type) interface{} {
+	val := reflect.New(typ)
+	valIface := val.Interface()
+	// Checks for panics unmarshalling arbitrary data
+	if err := json.Unmarshal(data, valIface); err != nil {
+		return nil
+	}
+	data1, err := json.Marshal(valIface)
+	if err != nil {
+		panic(fmt.Sprintf("Should be able to successfully marshal something we unmarshalled.\nErr: %v", err))
+	}
+
+	val1 := reflect.New(typ)
+	val1Iface := val1.Interface()
+	if err := json.Unmarshal(data1, val1Iface); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	if !dfuzzutil.DeepEqual(valIface, val1Iface) {
+		fmt.Printf("result0: %v\n", valIface)
+		fmt.Printf("result1: %v\n", val1Iface)
+		panic("not equal")
+	}
+
+	// JSON has no canonical form, but our own output should be stable
+	data2, err := json.Marshal(val1Iface)
+	if err != nil {
+		panic(fmt.Sprintf("should succeed if had done so previously.\nErr: %v", err))
+	}
+	if !bytes.Equal(data1, data2) {
+		fmt.Printf("json0: %s\n", data1)
+		fmt.Printf("json1: %s\n", data2)
+		panic("marshal-unmarshal-marshal isn't stable")
+	}
+
+	// The same value sent over libp2p has to come out the same
+	if cborIface, ok := valIface.(CBORer); ok {
+		checkCBORAgrees(cborIface, typ)
+	}
+	return valIface
+}
+
+// checkCBORAgrees round-trips a JSON decoded value through CBOR and compares
+func checkCBORAgrees(valIface CBORer, typ reflect.Type) {
+	buf := new(bytes.Buffer)
+	if err := valIface.MarshalCBOR(buf); err != nil {
+		// JSON accepts values CBOR can't write, e.g. a CID.undef
+		return
+	}
+	val1 := reflect.New(typ)
+	val1Iface := val1.Interface().(CBORer)
+	if err := val1Iface.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal CBOR we made from a JSON value.\nErr: %v", err))
+	}
+	if !dfuzzutil.DeepEqual(valIface, val1Iface) {
+		fmt.Printf("json: %#v\n", valIface)
+		fmt.Printf("cbor: %#v\n", val1Iface)
+		panic("JSON and CBOR forms of the same value disagree")
+	}
+}
+
+// PtrToType(typ) should survive json.Marshal
+func jsonFuzzUtilStructured(data []byte, typ reflect.Type) int {
+	f := newStructuredFuzzer(data)
+	val := reflect.New(typ)
+	valIface := val.Interface()
+	f.Fuzz(valIface)
+
+	rawVal, err := json.Marshal(valIface)
+	if err != nil {
+		return 0
+	}
+	val1Iface := jsonFuzzUtilRaw(rawVal, typ)
+	if val1Iface == nil {
+		fmt.Printf("Generated struct: %#v\n", valIface)
+		fmt.Printf("Initial serialized value: %s\n", rawVal)
+		panic("should be able to unmarshal something we made")
+	}
+	if !dfuzzutil.DeepEqual(valIface, val1Iface) {
+		fmt.Printf("req0: %#v\n", valIface)
+		fmt.Printf("req1: %#v\n", val1Iface)
+		panic("not equal")
+	}
+	return 1
+}
+
+// newStructuredFuzzer returns a gofuzz Fuzzer that can generate valid CIDs, addresses, big ints, bitfields,
+// tipsets and actor states
+// By default these come out as zero values or random strings, which never survive a JSON round-trip
+func newStructuredFuzzer(data []byte) *gfuzz.Fuzzer {
+	return gfuzz.NewFromGoFuzz(data).NilChance(0).Funcs(
+		func(c *cid.Cid, cont gfuzz.Continue) {
+			var b []byte
+			cont.Fuzz(&b)
+			*c = sumCid(b)
+		},
+		func(a *goaddr.Address, cont gfuzz.Continue) {
+			addr, err := goaddr.NewIDAddress(cont.Uint64())
+			if err != nil {
+				panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+			}
+			*a = addr
+		},
+		func(b *big.Int, cont gfuzz.Continue) {
+			*b = big.NewInt(cont.Int63())
+			if cont.RandBool() {
+				*b = big.Neg(*b)
+			}
+		},
+		func(bf *bitfield.BitField, cont gfuzz.Continue) {
+			var set []uint64
+			cont.Fuzz(&set)
+			*bf = bitfield.NewFromSet(set)
+		},
+		func(t *time.Time, cont gfuzz.Continue) {
+			// JSON keeps neither the monotonic clock nor the location
+			*t = time.Unix(cont.Int63n(1<<40), 0).UTC()
+		},
+		// A TipSet only has unexported fields, left alone it comes out empty and
+		// NewTipSet refuses it when unmarshalling
+		func(ts *types.TipSet, cont gfuzz.Continue) {
+			blk := new(types.BlockHeader)
+			cont.Fuzz(blk)
+			built, err := types.NewTipSet([]*types.BlockHeader{blk})
+			if err != nil {
+				panic(fmt.Sprintf("Bug in harness, couldn't create tipset: %v", err))
+			}
+			*ts = *built
+		},
+		// gofuzz can't fill an interface{}, a string survives JSON as itself
+		func(s *api.ActorState, cont gfuzz.Continue) {
+			cont.Fuzz(&s.Balance)
+			var state string
+			cont.Fuzz(&state)
+			s.State = state
+		},
+	)
+}
+
+// fuzzCid generates a valid CID from fuzz data
+// gofuzz fills cid.Cid with a random string, which never decodes
+func fuzzCid(f *gfuzz.Fuzzer) cid.Cid {
+	var b []byte
+	f.Fuzz(&b)
+	return sumCid(b)
+}
+
+func sumCid(b []byte) cid.Cid {
+	c, err := cid.NewPrefixV1(cid.Raw, mh.SHA2_256).Sum(b)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create CID: %v", err))
+	}
+	return c
+}
+
+// ffi sorts sector infos by the bytes of their sealed CID
+func sealedCidLess(a, b cid.Cid) bool {
+	return bytes.Compare(a.Bytes(), b.Bytes()) < 0
+}
+
+// checkSorted checks sealed is in ffi's order, and that sorting it again keeps the
+// order, duplicates included
+func checkSorted(name string, sealed, resorted []cid.Cid) {
+	if !sort.SliceIsSorted(sealed, func(i, j int) bool {
+		return sealedCidLess(sealed[i], sealed[j])
+	}) {
+		fmt.Printf("values: %v\n", sealed)
+		panic(fmt.Sprintf("%s holds unsorted entries", name))
+	}
+	if len(resorted) != len(sealed) {
+		panic(fmt.Sprintf("Re-sorting changed the number of entries: %d != %d", len(sealed), len(resorted)))
+	}
+	for i := range sealed {
+		if !sealed[i].Equals(resorted[i]) {
+			panic(fmt.Sprintf("Re-sorting moved entry %d", i))
+		}
+	}
+}
+
+func publicSealed(vals []ffi.PublicSectorInfo) []cid.Cid {
+	out := make([]cid.Cid, len(vals))
+	for i := range vals {
+		out[i] = vals[i].SealedCID
+	}
+	return out
+}
+
+func privateSealed(vals []ffi.PrivateSectorInfo) []cid.Cid {
+	out := make([]cid.Cid, len(vals))
+	for i := range vals {
+		out[i] = vals[i].SealedCID
+	}
+	return out
+}
+
+// The constructors sort their arguments in place, so they're given a copy to re-sort
+
+func checkSortedPublic(vals []ffi.PublicSectorInfo) {
+	resorted := ffi.NewSortedPublicSectorInfo(append([]ffi.PublicSectorInfo(nil), vals...)...).Values()
+	checkSorted("SortedPublicSectorInfo", publicSealed(vals), publicSealed(resorted))
+}
+
+func checkSortedPrivate(vals []ffi.PrivateSectorInfo) {
+	resorted := ffi.NewSortedPrivateSectorInfo(append([]ffi.PrivateSectorInfo(nil), vals...)...).Values()
+	checkSorted("SortedPrivateSectorInfo", privateSealed(vals), privateSealed(resorted))
+}
+
+// Fuzzing SortedPublicSectorInfo unmarshal/marshal from raw byteslice
+// UnmarshalJSON doesn't sort, so only the round-trip is checked here
+func FuzzSortedPublicSectorInfoRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, reflect.TypeOf(ffi.SortedPublicSectorInfo{})) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SortedPrivateSectorInfo unmarshal/marshal from raw byteslice
+// UnmarshalJSON doesn't sort, so only the round-trip is checked here
+func FuzzSortedPrivateSectorInfoRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, reflect.TypeOf(ffi.SortedPrivateSectorInfo{})) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SortedPublicSectorInfo marshal/unmarshal from generated entries
+func FuzzSortedPublicSectorInfoStructured(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var infos []ffi.PublicSectorInfo
+	f.Fuzz(&infos)
+	for i := range infos {
+		infos[i].SealedCID = fuzzCid(f)
+	}
+	// Feed some duplicates through as well
+	var dup bool
+	f.Fuzz(&dup)
+	if dup && len(infos) > 0 {
+		infos = append(infos, infos[0])
+	}
+	sorted := ffi.NewSortedPublicSectorInfo(infos...)
+	checkSortedPublic(sorted.Values())
+
+	raw, err := sorted.MarshalJSON()
+	if err != nil {
+		return 0
+	}
+	out := jsonFuzzUtilRaw(raw, reflect.TypeOf(ffi.SortedPublicSectorInfo{}))
+	if out == nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made: %s", raw))
+	}
+	if !dfuzzutil.DeepEqual(sorted.Values(), out.(*ffi.SortedPublicSectorInfo).Values()) {
+		fmt.Printf("req0: %#v\n", sorted.Values())
+		fmt.Printf("req1: %#v\n", out.(*ffi.SortedPublicSectorInfo).Values())
+		panic("not equal")
+	}
+	return 1
+}
+
+// Fuzzing SortedPrivateSectorInfo marshal/unmarshal from generated entries
+func FuzzSortedPrivateSectorInfoStructured(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var infos []ffi.PrivateSectorInfo
+	f.Fuzz(&infos)
+	for i := range infos {
+		infos[i].SealedCID = fuzzCid(f)
+	}
+	var dup bool
+	f.Fuzz(&dup)
+	if dup && len(infos) > 0 {
+		infos = append(infos, infos[0])
+	}
+	sorted := ffi.NewSortedPrivateSectorInfo(infos...)
+	checkSortedPrivate(sorted.Values())
+
+	raw, err := sorted.MarshalJSON()
+	if err != nil {
+		return 0
+	}
+	out := jsonFuzzUtilRaw(raw, reflect.TypeOf(ffi.SortedPrivateSectorInfo{}))
+	if out == nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made: %s", raw))
+	}
+	if !dfuzzutil.DeepEqual(sorted.Values(), out.(*ffi.SortedPrivateSectorInfo).Values()) {
+		fmt.Printf("req0: %#v\n", sorted.Values())
+		fmt.Printf("req1: %#v\n", out.(*ffi.SortedPrivateSectorInfo).Values())
+		panic("not equal")
+	}
+	return 1
+}
+
+// Fuzzing TipSetKey JSON unmarshal/marshal from raw byteslice
+func FuzzTipSetKeyJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["TipSetKey"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing TipSetKey JSON marshal/unmarshal from generated struct
+func FuzzTipSetKeyJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["TipSetKey"])
+}
+
+// Fuzzing BigInt JSON unmarshal/marshal from raw byteslice
+func FuzzBigIntJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["BigInt"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing BigInt JSON marshal/unmarshal from generated struct
+func FuzzBigIntJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["BigInt"])
+}
+
+// Fuzzing Address JSON unmarshal/marshal from raw byteslice
+func FuzzAddressJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["Address"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing Address JSON marshal/unmarshal from generated struct
+func FuzzAddressJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["Address"])
+}
+
+// Fuzzing Cid JSON unmarshal/marshal from raw byteslice
+func FuzzCidJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["Cid"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing Cid JSON marshal/unmarshal from generated struct
+func FuzzCidJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["Cid"])
+}
+
+// Fuzzing MinerInfo JSON unmarshal/marshal from raw byteslice
+func FuzzMinerInfoJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MinerInfo"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MinerInfo JSON marshal/unmarshal from generated struct
+func FuzzMinerInfoJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MinerInfo"])
+}
+
+// Fuzzing MsgLookup JSON unmarshal/marshal from raw byteslice
+func FuzzMsgLookupJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MsgLookup"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MsgLookup JSON marshal/unmarshal from generated struct
+func FuzzMsgLookupJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MsgLookup"])
+}
+
+// Fuzzing MinerPower JSON unmarshal/marshal from raw byteslice
+func FuzzMinerPowerJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MinerPower"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MinerPower JSON marshal/unmarshal from generated struct
+func FuzzMinerPowerJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MinerPower"])
+}
+
+// Fuzzing MinerSectors JSON unmarshal/marshal from raw byteslice
+func FuzzMinerSectorsJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MinerSectors"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MinerSectors JSON marshal/unmarshal from generated struct
+func FuzzMinerSectorsJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MinerSectors"])
+}
+
+// Fuzzing BlockMessages JSON unmarshal/marshal from raw byteslice
+func FuzzBlockMessagesJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["BlockMessages"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing BlockMessages JSON marshal/unmarshal from generated struct
+func FuzzBlockMessagesJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["BlockMessages"])
+}
+
+// Fuzzing Message JSON unmarshal/marshal from raw byteslice
+func FuzzMessageJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["Message"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing Message JSON marshal/unmarshal from generated struct
+func FuzzMessageJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["Message"])
+}
+
+// Fuzzing ActorState JSON unmarshal/marshal from raw byteslice
+func FuzzActorStateJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["ActorState"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing ActorState JSON marshal/unmarshal from generated struct
+func FuzzActorStateJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["ActorState"])
+}
+
+// Fuzzing MarketBalance JSON unmarshal/marshal from raw byteslice
+func FuzzMarketBalanceJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MarketBalance"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MarketBalance JSON marshal/unmarshal from generated struct
+func FuzzMarketBalanceJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MarketBalance"])
+}
+
+// Fuzzing MarketDeal JSON unmarshal/marshal from raw byteslice
+func FuzzMarketDealJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MarketDeal"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MarketDeal JSON marshal/unmarshal from generated struct
+func FuzzMarketDealJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MarketDeal"])
+}
+
+// Fuzzing DealInfo JSON unmarshal/marshal from raw byteslice
+func FuzzDealInfoJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["DealInfo"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing DealInfo JSON marshal/unmarshal from generated struct
+func FuzzDealInfoJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["DealInfo"])
+}
+
+// Fuzzing StartDealParams JSON unmarshal/marshal from raw byteslice
+func FuzzStartDealParamsJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["StartDealParams"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing StartDealParams JSON marshal/unmarshal from generated struct
+func FuzzStartDealParamsJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["StartDealParams"])
+}
+
+// Fuzzing QueryOffer JSON unmarshal/marshal from raw byteslice
+func FuzzQueryOfferJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["QueryOffer"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing QueryOffer JSON marshal/unmarshal from generated struct
+func FuzzQueryOfferJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["QueryOffer"])
+}
+
+// Fuzzing RetrievalOrder JSON unmarshal/marshal from raw byteslice
+func FuzzRetrievalOrderJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["RetrievalOrder"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing RetrievalOrder JSON marshal/unmarshal from generated struct
+func FuzzRetrievalOrderJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["RetrievalOrder"])
+}
+
+// Fuzzing FileRef JSON unmarshal/marshal from raw byteslice
+func FuzzFileRefJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["FileRef"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing FileRef JSON marshal/unmarshal from generated struct
+func FuzzFileRefJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["FileRef"])
+}
+
+// Fuzzing PCHInfo JSON unmarshal/marshal from raw byteslice
+func FuzzPCHInfoJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["PCHInfo"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing PCHInfo JSON marshal/unmarshal from generated struct
+func FuzzPCHInfoJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["PCHInfo"])
+}
+
+// Fuzzing PaymentInfo JSON unmarshal/marshal from raw byteslice
+func FuzzPaymentInfoJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["PaymentInfo"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing PaymentInfo JSON marshal/unmarshal from generated struct
+func FuzzPaymentInfoJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["PaymentInfo"])
+}
+
+// Fuzzing VoucherSpec JSON unmarshal/marshal from raw byteslice
+func FuzzVoucherSpecJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["VoucherSpec"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing VoucherSpec JSON marshal/unmarshal from generated struct
+func FuzzVoucherSpecJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["VoucherSpec"])
+}
+
+// Fuzzing SealedRef JSON unmarshal/marshal from raw byteslice
+func FuzzSealedRefJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["SealedRef"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SealedRef JSON marshal/unmarshal from generated struct
+func FuzzSealedRefJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["SealedRef"])
+}
+
+// Fuzzing SealedRefs JSON unmarshal/marshal from raw byteslice
+func FuzzSealedRefsJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["SealedRefs"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SealedRefs JSON marshal/unmarshal from generated struct
+func FuzzSealedRefsJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["SealedRefs"])
+}
+
+// Fuzzing SealTicket JSON unmarshal/marshal from raw byteslice
+func FuzzSealTicketJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["SealTicket"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SealTicket JSON marshal/unmarshal from generated struct
+func FuzzSealTicketJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["SealTicket"])
+}
+
+// Fuzzing SealSeed JSON unmarshal/marshal from raw byteslice
+func FuzzSealSeedJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["SealSeed"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SealSeed JSON marshal/unmarshal from generated struct
+func FuzzSealSeedJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["SealSeed"])
+}
+
+// Fuzzing SectorInfo JSON unmarshal/marshal from raw byteslice
+func FuzzSectorInfoJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["SectorInfo"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SectorInfo JSON marshal/unmarshal from generated struct
+func FuzzSectorInfoJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["SectorInfo"])
+}
+
+// Fuzzing SyncState JSON unmarshal/marshal from raw byteslice
+func FuzzSyncStateJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["SyncState"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing SyncState JSON marshal/unmarshal from generated struct
+func FuzzSyncStateJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["SyncState"])
+}
+
+// Fuzzing ActiveSync JSON unmarshal/marshal from raw byteslice
+func FuzzActiveSyncJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["ActiveSync"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing ActiveSync JSON marshal/unmarshal from generated struct
+func FuzzActiveSyncJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["ActiveSync"])
+}
+
+// Fuzzing MpoolUpdate JSON unmarshal/marshal from raw byteslice
+func FuzzMpoolUpdateJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MpoolUpdate"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MpoolUpdate JSON marshal/unmarshal from generated struct
+func FuzzMpoolUpdateJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MpoolUpdate"])
+}
+
+// Fuzzing MethodCall JSON unmarshal/marshal from raw byteslice
+func FuzzMethodCallJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["MethodCall"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing MethodCall JSON marshal/unmarshal from generated struct
+func FuzzMethodCallJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["MethodCall"])
+}
+
+// Fuzzing InvocResult JSON unmarshal/marshal from raw byteslice
+func FuzzInvocResultJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["InvocResult"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing InvocResult JSON marshal/unmarshal from generated struct
+func FuzzInvocResultJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["InvocResult"])
+}
+
+// Fuzzing ComputeStateOutput JSON unmarshal/marshal from raw byteslice
+func FuzzComputeStateOutputJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["ComputeStateOutput"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing ComputeStateOutput JSON marshal/unmarshal from generated struct
+func FuzzComputeStateOutputJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["ComputeStateOutput"])
+}
+
+// Fuzzing Version JSON unmarshal/marshal from raw byteslice
+func FuzzVersionJSONRaw(data []byte) int {
+	if jsonFuzzUtilRaw(data, jsonTypeMap["Version"]) == nil {
+		return 0
+	}
+	return 1
+}
+
+// Fuzzing Version JSON marshal/unmarshal from generated struct
+func FuzzVersionJSONStructured(data []byte) int {
+	return jsonFuzzUtilStructured(data, jsonTypeMap["Version"])
+}
@@ -3,7 +3,6 @@ package libfuzzer
 import (
 	"bytes"
 
-	ffi "github.com/filecoin-project/filecoin-ffi"
 	mock "github.com/filecoin-project/sector-storage/mock"
 	gfuzz "github.com/google/gofuzz"
 
@@ -11,26 +10,6 @@ import (
 	graphmessage "github.com/ipfs/go-graphsync/message"
 )
 
-// Fuzzing SortedPublicSectorInfo unmarshal/marshal from raw byteslice
-func FuzzSortedPublicSectorInfoRaw(data []byte) int {
-	out := ffi.SortedPublicSectorInfo{}
-	err := out.UnmarshalJSON(data)
-	if err != nil {
-		return 0
-	}
-	return 1
-}
-
-// Fuzzing SortedPrivateSectorInfo unmarshal/marshal from raw byteslice
-func FuzzSortedPrivateSectorInfoRaw(data []byte) int {
-	out := ffi.SortedPublicSectorInfo{}
-	err := out.UnmarshalJSON(data)
-	if err != nil {
-		return 0
-	}
-	return 1
-}
-
 func FuzzMockSectorMgr(data []byte) int {
 	out := mock.SectorMgr{}
 	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
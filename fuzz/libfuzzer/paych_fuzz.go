@@ -0,0 +1,387 @@
+// Fuzzing the payment channel voucher lifecycle against both the paych actor in the
+// specs-actors mock runtime and the Lotus paychmgr reading the same channel state
+// Lives here because paychmgr pulls in the state manager, and with it ffi
+
+package libfuzzer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/state"
+	"github.com/filecoin-project/lotus/chain/stmgr"
+	"github.com/filecoin-project/lotus/chain/store"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	"github.com/filecoin-project/lotus/node/impl/full"
+	"github.com/filecoin-project/lotus/paychmgr"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/account"
+	"github.com/filecoin-project/specs-actors/actors/builtin/paych"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/minio/blake2b-simd"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Upper bound on the steps in a scenario
+const maxPaychSteps = 32
+
+var (
+	paychAddr     = mockrt.IDAddress(1002)
+	paychFromAddr = mockrt.IDAddress(100)
+	paychToAddr   = mockrt.IDAddress(101)
+)
+
+const (
+	paychOpVoucher = iota
+	paychOpSettle
+	paychOpCollect
+	numPaychOps
+)
+
+// One step of a payment channel scenario, the fields used depend on Kind
+type paychOp struct {
+	Kind uint8
+	// Allocate a new lane rather than reusing one
+	NewLane bool
+	Lane    uint8
+	// Added to the lane's last nonce, 0 reuses it
+	Nonce  uint8
+	Amount uint32
+	// Merge another lane into this one
+	Merge      bool
+	MergeLane  uint8
+	MergeNonce uint8
+	// A hashed secret the redeemer has to present
+	Secret    []byte
+	BadSecret bool
+	// Absolute epochs, TimeLockMax of 0 means no upper bound
+	TimeLockMin uint8
+	TimeLockMax uint8
+	// Signed with the channel recipient's key instead of the creator's
+	WrongSigner bool
+	// Settle and collect from the creator rather than the recipient
+	FromCreator bool
+	Advance     uint8
+}
+
+func newPaychState() cbg.CBORUnmarshaler {
+	return new(paych.State)
+}
+
+// paychBlockstore lets the shared chain store drop the previous input's blocks
+type paychBlockstore struct {
+	blockstore.Blockstore
+}
+
+func (b *paychBlockstore) reset() {
+	b.Blockstore = blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+}
+
+// Created once, the chain store starts a goroutine that is never stopped
+// Its blocks are dropped between inputs instead
+var paychChain struct {
+	once sync.Once
+	bs   *paychBlockstore
+	cs   *store.ChainStore
+	sm   *stmgr.StateManager
+}
+
+func setupPaychChain() {
+	paychChain.bs = new(paychBlockstore)
+	paychChain.bs.reset()
+	paychChain.cs = store.NewChainStore(paychChain.bs, dssync.MutexWrap(ds.NewMapDatastore()), nil)
+	paychChain.sm = stmgr.NewStateManager(paychChain.cs)
+}
+
+// A minimal chain for paychmgr to read the channel state from
+// Every sync makes a new tipset, whose parent state holds the actors, the head
+type paychNode struct {
+	cst  cbor.IpldStore
+	cs   *store.ChainStore
+	pm   *paychmgr.Manager
+	head *types.BlockHeader
+}
+
+// newPaychNode empties the shared chain and gives it a manager with a store of its own
+func newPaychNode() *paychNode {
+	paychChain.once.Do(setupPaychChain)
+	paychChain.bs.reset()
+	// Wired to the same chain, there's no mpool as the harness never has the manager send
+	api := paychmgr.ManagerApi{
+		StateAPI:  full.StateAPI{StateManager: paychChain.sm, Chain: paychChain.cs},
+		WalletAPI: full.WalletAPI{StateManager: paychChain.sm},
+	}
+	pm := paychmgr.NewManager(paychChain.sm, paychmgr.NewStore(dssync.MutexWrap(ds.NewMapDatastore())), api)
+	return &paychNode{cst: cbor.NewCborStore(paychChain.bs), cs: paychChain.cs, pm: pm}
+}
+
+// sync puts the channel as the actor sees it, and both account actors, in a new head
+func (n *paychNode) sync(ctx context.Context, st *paych.State, balance abi.TokenAmount) error {
+	tree, err := state.NewStateTree(n.cst)
+	if err != nil {
+		return err
+	}
+	put := func(a goaddr.Address, code cid.Cid, head cbg.CBORMarshaler, bal abi.TokenAmount) error {
+		c, err := n.cst.Put(ctx, head)
+		if err != nil {
+			return err
+		}
+		return tree.SetActor(a, &types.Actor{Code: code, Head: c, Balance: bal})
+	}
+	keys := sigKeys.keys
+	if err := put(paychFromAddr, builtin.AccountActorCodeID, &account.State{Address: keys[0].addr}, big.Zero()); err != nil {
+		return err
+	}
+	if err := put(paychToAddr, builtin.AccountActorCodeID, &account.State{Address: keys[1].addr}, big.Zero()); err != nil {
+		return err
+	}
+	if err := put(paychAddr, builtin.PaymentChannelActorCodeID, st, balance); err != nil {
+		return err
+	}
+	root, err := tree.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	h := &types.BlockHeader{
+		Miner:                 paychFromAddr,
+		Ticket:                &types.Ticket{VRFProof: []byte{}},
+		ParentWeight:          types.NewInt(0),
+		ParentStateRoot:       root,
+		ParentMessageReceipts: root,
+		Messages:              root,
+	}
+	if n.head != nil {
+		h.Parents = []cid.Cid{n.head.Cid()}
+		h.Height = n.head.Height + 1
+	}
+	ts, err := types.NewTipSet([]*types.BlockHeader{h})
+	if err != nil {
+		return err
+	}
+	if err := n.cs.SetHead(ts); err != nil {
+		return err
+	}
+	n.head = h
+	return nil
+}
+
+func findPaychLane(st *paych.State, lane uint64) *paych.LaneState {
+	for _, ls := range st.LaneStates {
+		if ls.ID == lane {
+			return ls
+		}
+	}
+	return nil
+}
+
+// checkPaychState checks the channel never owes more than it holds
+func checkPaychState(st *paych.State, balance abi.TokenAmount) {
+	if st.ToSend.LessThan(big.Zero()) {
+		panic(fmt.Sprintf("negative ToSend %s", st.ToSend))
+	}
+	if st.ToSend.GreaterThan(balance) {
+		panic(fmt.Sprintf("ToSend %s above the channel balance %s", st.ToSend, balance))
+	}
+	if len(st.LaneStates) > paych.LaneLimit {
+		panic(fmt.Sprintf("%d lanes, the limit is %d", len(st.LaneStates), paych.LaneLimit))
+	}
+	for i := 1; i < len(st.LaneStates); i++ {
+		if st.LaneStates[i-1].ID >= st.LaneStates[i].ID {
+			panic(fmt.Sprintf("lanes %d and %d not sorted", st.LaneStates[i-1].ID, st.LaneStates[i].ID))
+		}
+	}
+}
+
+// Fuzzing payment channel vouchers through paychmgr and the paych actor
+// For vouchers without merges both have to agree on validity, except where the actor
+// checks what paychmgr leaves to redemption time (time locks, secrets, settling).
+// Nothing may ever promise more than the channel holds
+func FuzzPaychVouchers(data []byte) int {
+	sigKeys.once.Do(setupSigKeys)
+	ctx := context.TODO()
+
+	f := newStructuredFuzzer(data)
+	var initial uint32
+	var ops []paychOp
+	f.Fuzz(&initial)
+	f.Fuzz(&ops)
+	if len(ops) > maxPaychSteps {
+		ops = ops[:maxPaychSteps]
+	}
+
+	balance := abi.NewTokenAmount(int64(initial))
+	rt := mockrt.NewRuntime(paychAddr, 0, balance)
+	rt.SetAddressActorType(paychFromAddr, builtin.AccountActorCodeID)
+	rt.SetAddressActorType(paychToAddr, builtin.AccountActorCodeID)
+	actor := paych.Actor{}
+	rt.SetCaller(builtin.InitActorAddr, builtin.InitActorCodeID)
+	rt.ExpectValidateCallerType(builtin.InitActorCodeID)
+	res := mockrt.InvokeReverting(rt, newPaychState, actor.Constructor, &paych.ConstructorParams{From: paychFromAddr, To: paychToAddr})
+	if res.MockFailure || res.Aborted {
+		return 0
+	}
+	var st paych.State
+	rt.GetState(&st)
+
+	node := newPaychNode()
+	if err := node.sync(ctx, &st, balance); err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't build the chain: %v", err))
+	}
+	if err := node.pm.TrackInboundChannel(ctx, paychAddr); err != nil {
+		panic(fmt.Sprintf("Couldn't track the channel: %v", err))
+	}
+	// Lanes are allocated by the sending side
+	out := paychmgr.NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+	err := out.TrackChannel(&paychmgr.ChannelInfo{
+		Channel:   paychAddr,
+		Control:   sigKeys.keys[0].addr,
+		Target:    sigKeys.keys[1].addr,
+		Direction: paychmgr.DirOutbound,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't track the channel: %v", err))
+	}
+	var lanes []uint64
+
+	epoch := abi.ChainEpoch(0)
+	for _, op := range ops {
+		epoch += abi.ChainEpoch(op.Advance)
+		rt.SetEpoch(epoch)
+		switch int(op.Kind) % numPaychOps {
+		case paychOpVoucher:
+			if op.NewLane || len(lanes) == 0 {
+				lane, err := out.AllocateLane(paychAddr)
+				if err != nil {
+					panic(fmt.Sprintf("Couldn't allocate a lane: %v", err))
+				}
+				for _, l := range lanes {
+					if l == lane {
+						panic(fmt.Sprintf("lane %d allocated twice", lane))
+					}
+				}
+				lanes = append(lanes, lane)
+			}
+			sv := &paych.SignedVoucher{
+				Lane:        lanes[int(op.Lane)%len(lanes)],
+				Nonce:       uint64(op.Nonce),
+				Amount:      abi.NewTokenAmount(int64(op.Amount)),
+				TimeLockMin: abi.ChainEpoch(op.TimeLockMin),
+			}
+			if op.TimeLockMax != 0 {
+				sv.TimeLockMax = abi.ChainEpoch(op.TimeLockMin) + abi.ChainEpoch(op.TimeLockMax)
+			}
+			ls := findPaychLane(&st, sv.Lane)
+			if ls != nil {
+				sv.Nonce += ls.Nonce
+			}
+			if op.Merge && len(lanes) > 1 {
+				sv.Merges = []paych.Merge{{Lane: lanes[int(op.MergeLane)%len(lanes)], Nonce: uint64(op.MergeNonce)}}
+			}
+			secret := op.Secret
+			if len(op.Secret) > 0 {
+				h := blake2b.Sum256(op.Secret)
+				sv.SecretPreimage = h[:]
+				if op.BadSecret {
+					secret = append(append([]byte{}, op.Secret...), 0)
+				}
+			}
+			key := sigKeys.keys[0]
+			if op.WrongSigner {
+				key = sigKeys.keys[1]
+			}
+			vb, err := sv.SigningBytes()
+			if err != nil {
+				return 0
+			}
+			sv.Signature, err = sigs.Sign(key.typ, key.priv, vb)
+			if err != nil {
+				panic(fmt.Sprintf("Couldn't sign voucher: %v", err))
+			}
+
+			lotusErr := node.pm.CheckVoucherValid(ctx, paychAddr, sv)
+
+			// Submitted by the recipient, so the actor checks the creator's signature
+			rt.SetCaller(paychToAddr, builtin.AccountActorCodeID)
+			rt.ExpectValidateCallerAddr(paychFromAddr, paychToAddr)
+			rt.ExpectVerifySignature(*sv.Signature, paychFromAddr, vb, sigs.Verify(sv.Signature, sigKeys.keys[0].addr, vb))
+			res := mockrt.InvokeReverting(rt, newPaychState, actor.UpdateChannelState, &paych.UpdateChannelStateParams{Sv: *sv, Secret: secret})
+			if res.MockFailure {
+				return 0
+			}
+			// Only vouchers the chain took are stored, so paychmgr's lanes don't run
+			// ahead of the actor's. It reads the chain from before the redemption
+			if !res.Aborted && lotusErr == nil {
+				delta, err := node.pm.AddVoucher(ctx, paychAddr, sv, nil, types.NewInt(0))
+				if err == nil && delta.GreaterThan(big.Sub(balance, st.ToSend)) {
+					panic(fmt.Sprintf("paychmgr accepted a voucher worth %s with %s left in the channel", delta, big.Sub(balance, st.ToSend)))
+				}
+			}
+
+			redeemed := big.Zero()
+			if ls != nil {
+				redeemed = ls.Redeemed
+			}
+			toSend := big.Add(st.ToSend, big.Sub(sv.Amount, redeemed))
+			redeemable := (st.SettlingAt == 0 || epoch < st.SettlingAt) &&
+				epoch >= sv.TimeLockMin && (sv.TimeLockMax == 0 || epoch <= sv.TimeLockMax) &&
+				(len(sv.SecretPreimage) == 0 || !op.BadSecret) &&
+				!toSend.LessThan(big.Zero()) && !toSend.GreaterThan(balance) &&
+				(ls != nil || len(st.LaneStates) < paych.LaneLimit)
+			if len(sv.Merges) == 0 {
+				if !res.Aborted && lotusErr != nil {
+					panic(fmt.Sprintf("actor redeemed a voucher paychmgr rejects: %v", lotusErr))
+				}
+				if res.Aborted && lotusErr == nil && redeemable {
+					panic(fmt.Sprintf("paychmgr accepted a voucher the actor rejects with %d", res.Code))
+				}
+			}
+		case paychOpSettle, paychOpCollect:
+			if op.FromCreator {
+				rt.SetCaller(paychFromAddr, builtin.AccountActorCodeID)
+			} else {
+				rt.SetCaller(paychToAddr, builtin.AccountActorCodeID)
+			}
+			rt.ExpectValidateCallerAddr(paychFromAddr, paychToAddr)
+			if int(op.Kind)%numPaychOps == paychOpSettle {
+				res := mockrt.InvokeReverting(rt, newPaychState, actor.Settle, (*adt.EmptyValue)(nil))
+				if res.MockFailure {
+					return 0
+				}
+				break
+			}
+			rt.ExpectSend(paychFromAddr, builtin.MethodSend, nil, big.Sub(balance, st.ToSend), nil, exitcode.Ok)
+			rt.ExpectSend(paychToAddr, builtin.MethodSend, nil, st.ToSend, nil, exitcode.Ok)
+			res := mockrt.InvokeReverting(rt, newPaychState, actor.Collect, (*adt.EmptyValue)(nil))
+			if res.MockFailure {
+				return 0
+			}
+			if !res.Aborted {
+				if st.SettlingAt == 0 || epoch < st.SettlingAt {
+					panic(fmt.Sprintf("channel collected at %d, settling at %d", epoch, st.SettlingAt))
+				}
+				// the channel is done
+				return 1
+			}
+		}
+
+		rt.GetState(&st)
+		checkPaychState(&st, balance)
+		if err := node.sync(ctx, &st, balance); err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't build the chain: %v", err))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,153 @@
+// Fuzzing SignedMessage signature verification with locally generated keys
+// Lives here rather than in fuzz/ because the BLS signatures go through ffi
+
+package libfuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/sigs"
+	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
+	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+	gfuzz "github.com/google/gofuzz"
+)
+
+// A locally generated key and its address
+type sigKey struct {
+	typ  crypto.SigType
+	priv []byte
+	addr goaddr.Address
+}
+
+// Created once, key generation is slow and the keys don't need fuzzing
+var sigKeys struct {
+	once sync.Once
+	keys []sigKey
+}
+
+func setupSigKeys() {
+	for _, typ := range []crypto.SigType{crypto.SigTypeSecp256k1, crypto.SigTypeBLS} {
+		priv, err := sigs.Generate(typ)
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't generate key: %v", err))
+		}
+		pub, err := sigs.ToPublic(typ, priv)
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't derive public key: %v", err))
+		}
+		var addr goaddr.Address
+		if typ == crypto.SigTypeBLS {
+			addr, err = goaddr.NewBLSAddress(pub)
+		} else {
+			addr, err = goaddr.NewSecp256k1Address(pub)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+		}
+		sigKeys.keys = append(sigKeys.keys, sigKey{typ: typ, priv: priv, addr: addr})
+	}
+}
+
+// verifySignedMessage checks a signed message the way the mempool and syncer do
+func verifySignedMessage(smsg *types.SignedMessage) error {
+	return sigs.Verify(&smsg.Signature, smsg.Message.From, smsg.Message.Cid().Bytes())
+}
+
+// Mutations applied to a correctly signed message
+const (
+	sigMutateNone = iota
+	sigMutateMessage
+	sigMutateType
+	sigMutateFlipBit
+	sigMutateData
+	sigMutateTruncate
+	sigMutateOtherKeyAddr
+	sigMutateIDAddr
+	numSigMutations
+)
+
+// Fuzzing sigs.Verify on messages signed with local secp256k1 and BLS keys,
+// then mutated. Only the untouched pairs may verify, nothing may panic
+func FuzzSignedMessageVerify(data []byte) int {
+	sigKeys.once.Do(setupSigKeys)
+
+	f := newStructuredFuzzer(data)
+	var keyIdx, mutation uint8
+	f.Fuzz(&keyIdx)
+	f.Fuzz(&mutation)
+	key := sigKeys.keys[int(keyIdx)%len(sigKeys.keys)]
+
+	var msg types.Message
+	f.Fuzz(&msg)
+	msg.From = key.addr
+	sig, err := sigs.Sign(key.typ, key.priv, msg.Cid().Bytes())
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't sign message: %v", err))
+	}
+	orig := &types.SignedMessage{Message: msg, Signature: *sig}
+	if err := verifySignedMessage(orig); err != nil {
+		panic(fmt.Sprintf("Freshly signed message doesn't verify: %v", err))
+	}
+
+	// Go through the wire encoding, as a message received from the network would
+	raw, err := orig.Serialize()
+	if err != nil {
+		return 0
+	}
+	smsg, err := types.DecodeSignedMessage(raw)
+	if err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+
+	switch int(mutation) % numSigMutations {
+	case sigMutateNone:
+	case sigMutateMessage:
+		var value uint64
+		f.Fuzz(&value)
+		smsg.Message.Value = types.NewInt(value)
+		f.Fuzz(&smsg.Message.Nonce)
+		f.Fuzz(&smsg.Message.Params)
+	case sigMutateType:
+		f.Fuzz(&smsg.Signature.Type)
+	case sigMutateFlipBit:
+		if len(smsg.Signature.Data) > 0 {
+			var pos uint16
+			f.Fuzz(&pos)
+			smsg.Signature.Data[int(pos)%len(smsg.Signature.Data)] ^= 1 << (pos % 8)
+		}
+	case sigMutateData:
+		f.Fuzz(&smsg.Signature.Data)
+	case sigMutateTruncate:
+		var n uint8
+		f.Fuzz(&n)
+		smsg.Signature.Data = smsg.Signature.Data[:int(n)%(len(smsg.Signature.Data)+1)]
+	case sigMutateOtherKeyAddr:
+		// The other protocol's address, the signature type no longer matches
+		smsg.Message.From = sigKeys.keys[(int(keyIdx)+1)%len(sigKeys.keys)].addr
+	case sigMutateIDAddr:
+		id, err := goaddr.NewIDAddress(uint64(keyIdx))
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+		}
+		smsg.Message.From = id
+	}
+
+	err = verifySignedMessage(smsg)
+	untouched := smsg.Message.Cid() == orig.Message.Cid() &&
+		smsg.Signature.Type == orig.Signature.Type &&
+		bytes.Equal(smsg.Signature.Data, orig.Signature.Data)
+	if untouched && err != nil {
+		panic(fmt.Sprintf("Untouched signed message doesn't verify: %v", err))
+	}
+	if !untouched && err == nil {
+		fmt.Printf("original: %#v\n", orig)
+		fmt.Printf("mutated: %#v\n", smsg)
+		panic("Mutated signed message verifies")
+	}
+	return 1
+}
@@ -0,0 +1,258 @@
+package libfuzzer
+
+// Targets maps each harness name, as passed to -func, to the harness itself
+// Keep in sync when adding harnesses so they get replayed as regression tests
+var Targets = map[string]func([]byte) int{
+	"FuzzBlockSyncRequestRaw":                            FuzzBlockSyncRequestRaw,
+	"FuzzBlockSyncRequestStructured":                     FuzzBlockSyncRequestStructured,
+	"FuzzBlockSyncResponseRaw":                           FuzzBlockSyncResponseRaw,
+	"FuzzBlockSyncResponseStructured":                    FuzzBlockSyncResponseStructured,
+	"FuzzHelloMessageRaw":                                FuzzHelloMessageRaw,
+	"FuzzHelloMessageStructured":                         FuzzHelloMessageStructured,
+	"FuzzLatencyMessageRaw":                              FuzzLatencyMessageRaw,
+	"FuzzLatencyMessageStructured":                       FuzzLatencyMessageStructured,
+	"FuzzVoucherInfoRaw":                                 FuzzVoucherInfoRaw,
+	"FuzzVoucherInfoStructured":                          FuzzVoucherInfoStructured,
+	"FuzzChannelInfoRaw":                                 FuzzChannelInfoRaw,
+	"FuzzChannelInfoStructured":                          FuzzChannelInfoStructured,
+	"FuzzPaymentInfoRaw":                                 FuzzPaymentInfoRaw,
+	"FuzzPaymentInfoStructured":                          FuzzPaymentInfoStructured,
+	"FuzzSealedRefRaw":                                   FuzzSealedRefRaw,
+	"FuzzSealedRefStructured":                            FuzzSealedRefStructured,
+	"FuzzSealedRefsRaw":                                  FuzzSealedRefsRaw,
+	"FuzzSealedRefsStructured":                           FuzzSealedRefsStructured,
+	"FuzzSealTicketRaw":                                  FuzzSealTicketRaw,
+	"FuzzSealTicketStructured":                           FuzzSealTicketStructured,
+	"FuzzSealSeedRaw":                                    FuzzSealSeedRaw,
+	"FuzzSealSeedStructured":                             FuzzSealSeedStructured,
+	"FuzzActorRaw":                                       FuzzActorRaw,
+	"FuzzActorStructured":                                FuzzActorStructured,
+	"FuzzTipSetRaw":                                      FuzzTipSetRaw,
+	"FuzzTipSetStructured":                               FuzzTipSetStructured,
+	"FuzzSignedMessageRaw":                               FuzzSignedMessageRaw,
+	"FuzzSignedMessageStructured":                        FuzzSignedMessageStructured,
+	"FuzzMsgMetaRaw":                                     FuzzMsgMetaRaw,
+	"FuzzMsgMetaStructured":                              FuzzMsgMetaStructured,
+	"FuzzMessageReceiptRaw":                              FuzzMessageReceiptRaw,
+	"FuzzMessageReceiptStructured":                       FuzzMessageReceiptStructured,
+	"FuzzDealProposalRaw":                                FuzzDealProposalRaw,
+	"FuzzDealProposalStructured":                         FuzzDealProposalStructured,
+	"FuzzSectorInfoRaw":                                  FuzzSectorInfoRaw,
+	"FuzzSectorInfoStructured":                           FuzzSectorInfoStructured,
+	"FuzzPieceRaw":                                       FuzzPieceRaw,
+	"FuzzPieceStructured":                                FuzzPieceStructured,
+	"FuzzAddressRaw":                                     FuzzAddressRaw,
+	"FuzzAddressStructured":                              FuzzAddressStructured,
+	"FuzzDeferredRaw":                                    FuzzDeferredRaw,
+	"FuzzDeferredStructured":                             FuzzDeferredStructured,
+	"FuzzKVRaw":                                          FuzzKVRaw,
+	"FuzzKVStructured":                                   FuzzKVStructured,
+	"FuzzNodeRaw":                                        FuzzNodeRaw,
+	"FuzzNodeStructured":                                 FuzzNodeStructured,
+	"FuzzPointerRaw":                                     FuzzPointerRaw,
+	"FuzzPointerStructured":                              FuzzPointerStructured,
+	"FuzzNodeAmtRaw":                                     FuzzNodeAmtRaw,
+	"FuzzNodeAmtStructured":                              FuzzNodeAmtStructured,
+	"FuzzRootAmtRaw":                                     FuzzRootAmtRaw,
+	"FuzzRootAmtStructured":                              FuzzRootAmtStructured,
+	"FuzzTestEventRaw":                                   FuzzTestEventRaw,
+	"FuzzTestEventStructured":                            FuzzTestEventStructured,
+	"FuzzTestStateRaw":                                   FuzzTestStateRaw,
+	"FuzzTestStateStructured":                            FuzzTestStateStructured,
+	"FuzzDealScheduleRaw":                                FuzzDealScheduleRaw,
+	"FuzzDealScheduleStructured":                         FuzzDealScheduleStructured,
+	"FuzzDealInfoRaw":                                    FuzzDealInfoRaw,
+	"FuzzDealInfoStructured":                             FuzzDealInfoStructured,
+	"FuzzSendParamsRaw":                                  FuzzSendParamsRaw,
+	"FuzzSendParamsStructured":                           FuzzSendParamsStructured,
+	"FuzzMarketWithdrawBalanceParamsRaw":                 FuzzMarketWithdrawBalanceParamsRaw,
+	"FuzzMarketWithdrawBalanceParamsStructured":          FuzzMarketWithdrawBalanceParamsStructured,
+	"FuzzPublishStorageDealsParamsRaw":                   FuzzPublishStorageDealsParamsRaw,
+	"FuzzPublishStorageDealsParamsStructured":            FuzzPublishStorageDealsParamsStructured,
+	"FuzzVerifyDealsOnSectorProveCommitParamsRaw":        FuzzVerifyDealsOnSectorProveCommitParamsRaw,
+	"FuzzVerifyDealsOnSectorProveCommitParamsStructured": FuzzVerifyDealsOnSectorProveCommitParamsStructured,
+	"FuzzComputeDataCommitmentParamsRaw":                 FuzzComputeDataCommitmentParamsRaw,
+	"FuzzComputeDataCommitmentParamsStructured":          FuzzComputeDataCommitmentParamsStructured,
+	"FuzzOnMinerSectorsTerminateParamsRaw":               FuzzOnMinerSectorsTerminateParamsRaw,
+	"FuzzOnMinerSectorsTerminateParamsStructured":        FuzzOnMinerSectorsTerminateParamsStructured,
+	"FuzzCreateMinerParamsRaw":                           FuzzCreateMinerParamsRaw,
+	"FuzzCreateMinerParamsStructured":                    FuzzCreateMinerParamsStructured,
+	"FuzzDeleteMinerParamsRaw":                           FuzzDeleteMinerParamsRaw,
+	"FuzzDeleteMinerParamsStructured":                    FuzzDeleteMinerParamsStructured,
+	"FuzzEnrollCronEventParamsRaw":                       FuzzEnrollCronEventParamsRaw,
+	"FuzzEnrollCronEventParamsStructured":                FuzzEnrollCronEventParamsStructured,
+	"FuzzOnSectorTerminateParamsRaw":                     FuzzOnSectorTerminateParamsRaw,
+	"FuzzOnSectorTerminateParamsStructured":              FuzzOnSectorTerminateParamsStructured,
+	"FuzzOnSectorModifyWeightDescParamsRaw":              FuzzOnSectorModifyWeightDescParamsRaw,
+	"FuzzOnSectorModifyWeightDescParamsStructured":       FuzzOnSectorModifyWeightDescParamsStructured,
+	"FuzzOnSectorProveCommitParamsRaw":                   FuzzOnSectorProveCommitParamsRaw,
+	"FuzzOnSectorProveCommitParamsStructured":            FuzzOnSectorProveCommitParamsStructured,
+	"FuzzOnFaultBeginParamsRaw":                          FuzzOnFaultBeginParamsRaw,
+	"FuzzOnFaultBeginParamsStructured":                   FuzzOnFaultBeginParamsStructured,
+	"FuzzOnFaultEndParamsRaw":                            FuzzOnFaultEndParamsRaw,
+	"FuzzOnFaultEndParamsStructured":                     FuzzOnFaultEndParamsStructured,
+	"FuzzMinerConstructorParamsRaw":                      FuzzMinerConstructorParamsRaw,
+	"FuzzMinerConstructorParamsStructured":               FuzzMinerConstructorParamsStructured,
+	"FuzzSubmitWindowedPoStParamsRaw":                    FuzzSubmitWindowedPoStParamsRaw,
+	"FuzzSubmitWindowedPoStParamsStructured":             FuzzSubmitWindowedPoStParamsStructured,
+	"FuzzTerminateSectorsParamsRaw":                      FuzzTerminateSectorsParamsRaw,
+	"FuzzTerminateSectorsParamsStructured":               FuzzTerminateSectorsParamsStructured,
+	"FuzzChangePeerIDParamsRaw":                          FuzzChangePeerIDParamsRaw,
+	"FuzzChangePeerIDParamsStructured":                   FuzzChangePeerIDParamsStructured,
+	"FuzzProveCommitSectorParamsRaw":                     FuzzProveCommitSectorParamsRaw,
+	"FuzzProveCommitSectorParamsStructured":              FuzzProveCommitSectorParamsStructured,
+	"FuzzChangeWorkerAddressParamsRaw":                   FuzzChangeWorkerAddressParamsRaw,
+	"FuzzChangeWorkerAddressParamsStructured":            FuzzChangeWorkerAddressParamsStructured,
+	"FuzzExtendSectorExpirationParamsRaw":                FuzzExtendSectorExpirationParamsRaw,
+	"FuzzExtendSectorExpirationParamsStructured":         FuzzExtendSectorExpirationParamsStructured,
+	"FuzzDeclareFaultsParamsRaw":                         FuzzDeclareFaultsParamsRaw,
+	"FuzzDeclareFaultsParamsStructured":                  FuzzDeclareFaultsParamsStructured,
+	"FuzzDeclareFaultsRecoveredParamsRaw":                FuzzDeclareFaultsRecoveredParamsRaw,
+	"FuzzDeclareFaultsRecoveredParamsStructured":         FuzzDeclareFaultsRecoveredParamsStructured,
+	"FuzzReportConsensusFaultParamsRaw":                  FuzzReportConsensusFaultParamsRaw,
+	"FuzzReportConsensusFaultParamsStructured":           FuzzReportConsensusFaultParamsStructured,
+	"FuzzCheckSectorProvenParamsRaw":                     FuzzCheckSectorProvenParamsRaw,
+	"FuzzCheckSectorProvenParamsStructured":              FuzzCheckSectorProvenParamsStructured,
+	"FuzzMinerWithdrawBalanceParamsRaw":                  FuzzMinerWithdrawBalanceParamsRaw,
+	"FuzzMinerWithdrawBalanceParamsStructured":           FuzzMinerWithdrawBalanceParamsStructured,
+	"FuzzInitConstructorParamsRaw":                       FuzzInitConstructorParamsRaw,
+	"FuzzInitConstructorParamsStructured":                FuzzInitConstructorParamsStructured,
+	"FuzzExecParamsRaw":                                  FuzzExecParamsRaw,
+	"FuzzExecParamsStructured":                           FuzzExecParamsStructured,
+	"FuzzAddVerifierParamsRaw":                           FuzzAddVerifierParamsRaw,
+	"FuzzAddVerifierParamsStructured":                    FuzzAddVerifierParamsStructured,
+	"FuzzAddVerifiedClientParamsRaw":                     FuzzAddVerifiedClientParamsRaw,
+	"FuzzAddVerifiedClientParamsStructured":              FuzzAddVerifiedClientParamsStructured,
+	"FuzzUseBytesParamsRaw":                              FuzzUseBytesParamsRaw,
+	"FuzzUseBytesParamsStructured":                       FuzzUseBytesParamsStructured,
+	"FuzzRestoreBytesParamsRaw":                          FuzzRestoreBytesParamsRaw,
+	"FuzzRestoreBytesParamsStructured":                   FuzzRestoreBytesParamsStructured,
+	"FuzzCronConstructorParamsRaw":                       FuzzCronConstructorParamsRaw,
+	"FuzzCronConstructorParamsStructured":                FuzzCronConstructorParamsStructured,
+	"FuzzMultiSigConstructorParamsRaw":                   FuzzMultiSigConstructorParamsRaw,
+	"FuzzMultiSigConstructorParamsStructured":            FuzzMultiSigConstructorParamsStructured,
+	"FuzzProposeParamsRaw":                               FuzzProposeParamsRaw,
+	"FuzzProposeParamsStructured":                        FuzzProposeParamsStructured,
+	"FuzzAddSignerParamsRaw":                             FuzzAddSignerParamsRaw,
+	"FuzzAddSignerParamsStructured":                      FuzzAddSignerParamsStructured,
+	"FuzzRemoveSignerParamsRaw":                          FuzzRemoveSignerParamsRaw,
+	"FuzzRemoveSignerParamsStructured":                   FuzzRemoveSignerParamsStructured,
+	"FuzzTxnIDParamsRaw":                                 FuzzTxnIDParamsRaw,
+	"FuzzTxnIDParamsStructured":                          FuzzTxnIDParamsStructured,
+	"FuzzChangeNumApprovalsThresholdParamsRaw":           FuzzChangeNumApprovalsThresholdParamsRaw,
+	"FuzzChangeNumApprovalsThresholdParamsStructured":    FuzzChangeNumApprovalsThresholdParamsStructured,
+	"FuzzSwapSignerParamsRaw":                            FuzzSwapSignerParamsRaw,
+	"FuzzSwapSignerParamsStructured":                     FuzzSwapSignerParamsStructured,
+	"FuzzPaychConstructorParamsRaw":                      FuzzPaychConstructorParamsRaw,
+	"FuzzPaychConstructorParamsStructured":               FuzzPaychConstructorParamsStructured,
+	"FuzzUpdateChannelStateParamsRaw":                    FuzzUpdateChannelStateParamsRaw,
+	"FuzzUpdateChannelStateParamsStructured":             FuzzUpdateChannelStateParamsStructured,
+	"FuzzModVerifyParamsRaw":                             FuzzModVerifyParamsRaw,
+	"FuzzModVerifyParamsStructured":                      FuzzModVerifyParamsStructured,
+	"FuzzPaymentVerifyParamsRaw":                         FuzzPaymentVerifyParamsRaw,
+	"FuzzPaymentVerifyParamsStructured":                  FuzzPaymentVerifyParamsStructured,
+	"FuzzAwardBlockRewardParamsRaw":                      FuzzAwardBlockRewardParamsRaw,
+	"FuzzAwardBlockRewardParamsStructured":               FuzzAwardBlockRewardParamsStructured,
+	"FuzzSortedPublicSectorInfoRaw":                      FuzzSortedPublicSectorInfoRaw,
+	"FuzzSortedPrivateSectorInfoRaw":                     FuzzSortedPrivateSectorInfoRaw,
+	"FuzzMockSectorMgr":                                  FuzzMockSectorMgr,
+	"FuzzMockFromNet":                                    FuzzMockFromNet,
+	"FuzzBlockHeaderValidation":                          FuzzBlockHeaderValidation,
+	"FuzzSortedPublicSectorInfoStructured":               FuzzSortedPublicSectorInfoStructured,
+	"FuzzSortedPrivateSectorInfoStructured":              FuzzSortedPrivateSectorInfoStructured,
+	"FuzzTipSetKeyJSONRaw":                               FuzzTipSetKeyJSONRaw,
+	"FuzzTipSetKeyJSONStructured":                        FuzzTipSetKeyJSONStructured,
+	"FuzzBigIntJSONRaw":                                  FuzzBigIntJSONRaw,
+	"FuzzBigIntJSONStructured":                           FuzzBigIntJSONStructured,
+	"FuzzAddressJSONRaw":                                 FuzzAddressJSONRaw,
+	"FuzzAddressJSONStructured":                          FuzzAddressJSONStructured,
+	"FuzzCidJSONRaw":                                     FuzzCidJSONRaw,
+	"FuzzCidJSONStructured":                              FuzzCidJSONStructured,
+	"FuzzMinerInfoJSONRaw":                               FuzzMinerInfoJSONRaw,
+	"FuzzMinerInfoJSONStructured":                        FuzzMinerInfoJSONStructured,
+	"FuzzMsgLookupJSONRaw":                               FuzzMsgLookupJSONRaw,
+	"FuzzMsgLookupJSONStructured":                        FuzzMsgLookupJSONStructured,
+	"FuzzMinerPowerJSONRaw":                              FuzzMinerPowerJSONRaw,
+	"FuzzMinerPowerJSONStructured":                       FuzzMinerPowerJSONStructured,
+	"FuzzMinerSectorsJSONRaw":                            FuzzMinerSectorsJSONRaw,
+	"FuzzMinerSectorsJSONStructured":                     FuzzMinerSectorsJSONStructured,
+	"FuzzBlockMessagesJSONRaw":                           FuzzBlockMessagesJSONRaw,
+	"FuzzBlockMessagesJSONStructured":                    FuzzBlockMessagesJSONStructured,
+	"FuzzMessageJSONRaw":                                 FuzzMessageJSONRaw,
+	"FuzzMessageJSONStructured":                          FuzzMessageJSONStructured,
+	"FuzzActorStateJSONRaw":                              FuzzActorStateJSONRaw,
+	"FuzzActorStateJSONStructured":                       FuzzActorStateJSONStructured,
+	"FuzzMarketBalanceJSONRaw":                           FuzzMarketBalanceJSONRaw,
+	"FuzzMarketBalanceJSONStructured":                    FuzzMarketBalanceJSONStructured,
+	"FuzzMarketDealJSONRaw":                              FuzzMarketDealJSONRaw,
+	"FuzzMarketDealJSONStructured":                       FuzzMarketDealJSONStructured,
+	"FuzzDealInfoJSONRaw":                                FuzzDealInfoJSONRaw,
+	"FuzzDealInfoJSONStructured":                         FuzzDealInfoJSONStructured,
+	"FuzzStartDealParamsJSONRaw":                         FuzzStartDealParamsJSONRaw,
+	"FuzzStartDealParamsJSONStructured":                  FuzzStartDealParamsJSONStructured,
+	"FuzzQueryOfferJSONRaw":                              FuzzQueryOfferJSONRaw,
+	"FuzzQueryOfferJSONStructured":                       FuzzQueryOfferJSONStructured,
+	"FuzzRetrievalOrderJSONRaw":                          FuzzRetrievalOrderJSONRaw,
+	"FuzzRetrievalOrderJSONStructured":                   FuzzRetrievalOrderJSONStructured,
+	"FuzzFileRefJSONRaw":                                 FuzzFileRefJSONRaw,
+	"FuzzFileRefJSONStructured":                          FuzzFileRefJSONStructured,
+	"FuzzPCHInfoJSONRaw":                                 FuzzPCHInfoJSONRaw,
+	"FuzzPCHInfoJSONStructured":                          FuzzPCHInfoJSONStructured,
+	"FuzzPaymentInfoJSONRaw":                             FuzzPaymentInfoJSONRaw,
+	"FuzzPaymentInfoJSONStructured":                      FuzzPaymentInfoJSONStructured,
+	"FuzzVoucherSpecJSONRaw":                             FuzzVoucherSpecJSONRaw,
+	"FuzzVoucherSpecJSONStructured":                      FuzzVoucherSpecJSONStructured,
+	"FuzzSealedRefJSONRaw":                               FuzzSealedRefJSONRaw,
+	"FuzzSealedRefJSONStructured":                        FuzzSealedRefJSONStructured,
+	"FuzzSealedRefsJSONRaw":                              FuzzSealedRefsJSONRaw,
+	"FuzzSealedRefsJSONStructured":                       FuzzSealedRefsJSONStructured,
+	"FuzzSealTicketJSONRaw":                              FuzzSealTicketJSONRaw,
+	"FuzzSealTicketJSONStructured":                       FuzzSealTicketJSONStructured,
+	"FuzzSealSeedJSONRaw":                                FuzzSealSeedJSONRaw,
+	"FuzzSealSeedJSONStructured":                         FuzzSealSeedJSONStructured,
+	"FuzzSectorInfoJSONRaw":                              FuzzSectorInfoJSONRaw,
+	"FuzzSectorInfoJSONStructured":                       FuzzSectorInfoJSONStructured,
+	"FuzzSyncStateJSONRaw":                               FuzzSyncStateJSONRaw,
+	"FuzzSyncStateJSONStructured":                        FuzzSyncStateJSONStructured,
+	"FuzzActiveSyncJSONRaw":                              FuzzActiveSyncJSONRaw,
+	"FuzzActiveSyncJSONStructured":                       FuzzActiveSyncJSONStructured,
+	"FuzzMpoolUpdateJSONRaw":                             FuzzMpoolUpdateJSONRaw,
+	"FuzzMpoolUpdateJSONStructured":                      FuzzMpoolUpdateJSONStructured,
+	"FuzzMethodCallJSONRaw":                              FuzzMethodCallJSONRaw,
+	"FuzzMethodCallJSONStructured":                       FuzzMethodCallJSONStructured,
+	"FuzzInvocResultJSONRaw":                             FuzzInvocResultJSONRaw,
+	"FuzzInvocResultJSONStructured":                      FuzzInvocResultJSONStructured,
+	"FuzzComputeStateOutputJSONRaw":                      FuzzComputeStateOutputJSONRaw,
+	"FuzzComputeStateOutputJSONStructured":               FuzzComputeStateOutputJSONStructured,
+	"FuzzVersionJSONRaw":                                 FuzzVersionJSONRaw,
+	"FuzzVersionJSONStructured":                          FuzzVersionJSONStructured,
+	"FuzzVoucherInfoCrossEncoding":                       FuzzVoucherInfoCrossEncoding,
+	"FuzzChannelInfoCrossEncoding":                       FuzzChannelInfoCrossEncoding,
+	"FuzzPaymentInfoCrossEncoding":                       FuzzPaymentInfoCrossEncoding,
+	"FuzzSealedRefCrossEncoding":                         FuzzSealedRefCrossEncoding,
+	"FuzzSealedRefsCrossEncoding":                        FuzzSealedRefsCrossEncoding,
+	"FuzzSealTicketCrossEncoding":                        FuzzSealTicketCrossEncoding,
+	"FuzzSealSeedCrossEncoding":                          FuzzSealSeedCrossEncoding,
+	"FuzzActorCrossEncoding":                             FuzzActorCrossEncoding,
+	"FuzzSignedMessageCrossEncoding":                     FuzzSignedMessageCrossEncoding,
+	"FuzzMsgMetaCrossEncoding":                           FuzzMsgMetaCrossEncoding,
+	"FuzzMessageReceiptCrossEncoding":                    FuzzMessageReceiptCrossEncoding,
+	"FuzzDealProposalCrossEncoding":                      FuzzDealProposalCrossEncoding,
+	"FuzzAddressCrossEncoding":                           FuzzAddressCrossEncoding,
+	"FuzzPublishStorageDealsParamsCrossEncoding":         FuzzPublishStorageDealsParamsCrossEncoding,
+	"FuzzSubmitWindowedPoStParamsCrossEncoding":          FuzzSubmitWindowedPoStParamsCrossEncoding,
+	"FuzzTerminateSectorsParamsCrossEncoding":            FuzzTerminateSectorsParamsCrossEncoding,
+	"FuzzExtendSectorExpirationParamsCrossEncoding":      FuzzExtendSectorExpirationParamsCrossEncoding,
+	"FuzzDeclareFaultsParamsCrossEncoding":               FuzzDeclareFaultsParamsCrossEncoding,
+	"FuzzDeclareFaultsRecoveredParamsCrossEncoding":      FuzzDeclareFaultsRecoveredParamsCrossEncoding,
+	"FuzzCreateMinerParamsCrossEncoding":                 FuzzCreateMinerParamsCrossEncoding,
+	"FuzzExecParamsCrossEncoding":                        FuzzExecParamsCrossEncoding,
+	"FuzzProposeParamsCrossEncoding":                     FuzzProposeParamsCrossEncoding,
+	"FuzzUpdateChannelStateParamsCrossEncoding":          FuzzUpdateChannelStateParamsCrossEncoding,
+	"FuzzAwardBlockRewardParamsCrossEncoding":            FuzzAwardBlockRewardParamsCrossEncoding,
+	"FuzzSignedMessageVerify":                            FuzzSignedMessageVerify,
+	"FuzzBlockMsgMeta":                                   FuzzBlockMsgMeta,
+	"FuzzNewTipSet":                                      FuzzNewTipSet,
+	"FuzzTipSetKeyRaw":                                   FuzzTipSetKeyRaw,
+	"FuzzPaychVouchers":                                  FuzzPaychVouchers,
+}
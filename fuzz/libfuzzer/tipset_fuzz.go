@@ -0,0 +1,200 @@
+// Fuzzing TipSet construction and TipSetKey encodings
+// The TipSet registry entry only round-trips CBOR, these harnesses go through
+// types.NewTipSet with fuzzed, possibly inconsistent, block headers
+
+package libfuzzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	cid "github.com/ipfs/go-cid"
+)
+
+// Upper bound on the blocks put in a generated tipset
+const maxTipSetBlocks = 8
+
+// Inconsistencies introduced into an otherwise valid block set
+const (
+	tipSetMutateNone = iota
+	tipSetMutateHeight
+	tipSetMutateParents
+	tipSetMutateDupTicket
+	tipSetMutateDupBlock
+	tipSetMutateNilTicket
+	numTipSetMutations
+)
+
+// checkTipSetSorted checks blocks are ordered by ticket, ties broken by CID
+// Blocks without a ticket have no defined place and are skipped
+func checkTipSetSorted(blks []*types.BlockHeader) {
+	for i := 1; i < len(blks); i++ {
+		a, b := blks[i-1], blks[i]
+		if a.Ticket == nil || b.Ticket == nil {
+			continue
+		}
+		if bytes.Equal(a.Ticket.VRFProof, b.Ticket.VRFProof) {
+			if bytes.Compare(a.Cid().Bytes(), b.Cid().Bytes()) > 0 {
+				panic(fmt.Sprintf("blocks %d and %d with equal tickets not ordered by CID", i-1, i))
+			}
+			continue
+		}
+		if b.Ticket.Less(a.Ticket) {
+			panic(fmt.Sprintf("blocks %d and %d not ordered by ticket", i-1, i))
+		}
+	}
+}
+
+// checkTipSetKey checks the bytes and JSON forms of tsk round-trip
+func checkTipSetKey(tsk types.TipSetKey) {
+	fromBytes, err := types.TipSetKeyFromBytes(tsk.Bytes())
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't parse the bytes of %s: %v", tsk, err))
+	}
+	if fromBytes != tsk {
+		panic(fmt.Sprintf("bytes round-trip of %s gave %s", tsk, fromBytes))
+	}
+	if rebuilt := types.NewTipSetKey(tsk.Cids()...); rebuilt != tsk {
+		panic(fmt.Sprintf("NewTipSetKey(Cids()) of %s gave %s", tsk, rebuilt))
+	}
+	raw, err := json.Marshal(tsk)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't marshal %s: %v", tsk, err))
+	}
+	var fromJSON types.TipSetKey
+	if err := json.Unmarshal(raw, &fromJSON); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	if fromJSON != tsk {
+		panic(fmt.Sprintf("JSON round-trip of %s gave %s", tsk, fromJSON))
+	}
+}
+
+// Fuzzing types.NewTipSet with generated block headers
+// Inconsistent sets must be rejected with an error, consistent ones must come out
+// sorted with a key that doesn't depend on the input order
+func FuzzNewTipSet(data []byte) int {
+	f := newStructuredFuzzer(data)
+	var n, mutation uint8
+	var seed int64
+	f.Fuzz(&n)
+	f.Fuzz(&mutation)
+	f.Fuzz(&seed)
+
+	blks := make([]*types.BlockHeader, int(n)%(maxTipSetBlocks+1))
+	if len(blks) == 0 {
+		if _, err := types.NewTipSet(blks); err == nil {
+			panic("NewTipSet accepted an empty block set")
+		}
+		return 0
+	}
+	for i := range blks {
+		blks[i] = new(types.BlockHeader)
+		f.Fuzz(blks[i])
+		// share what NewTipSet requires to be shared
+		if i > 0 {
+			blks[i].Height = blks[0].Height
+			blks[i].Parents = blks[0].Parents
+			blks[i].ParentWeight = blks[0].ParentWeight
+			blks[i].ParentStateRoot = blks[0].ParentStateRoot
+			blks[i].ParentMessageReceipts = blks[0].ParentMessageReceipts
+		}
+	}
+	for _, b := range blks {
+		if _, err := b.Serialize(); err != nil {
+			return 0
+		}
+	}
+
+	consistent := true
+	last := blks[len(blks)-1]
+	switch int(mutation) % numTipSetMutations {
+	case tipSetMutateNone:
+	case tipSetMutateHeight:
+		if len(blks) > 1 {
+			last.Height++
+			consistent = false
+		}
+	case tipSetMutateParents:
+		if len(blks) > 1 {
+			last.Parents = append(append([]cid.Cid{}, last.Parents...), fuzzCid(f))
+			consistent = false
+		}
+	case tipSetMutateDupTicket:
+		// still valid, the tie is broken by CID
+		last.Ticket = blks[0].Ticket
+	case tipSetMutateDupBlock:
+		// NewTipSet doesn't check for the same block twice, accepting it is
+		// expected until it does
+		blks = append(blks, blks[0])
+	case tipSetMutateNilTicket:
+		// nor for a missing ticket, this has to be accepted without panicking
+		last.Ticket = nil
+	}
+
+	ts, err := types.NewTipSet(blks)
+	if err != nil {
+		if consistent {
+			panic(fmt.Sprintf("NewTipSet rejected a consistent block set: %v", err))
+		}
+		return 0
+	}
+	if !consistent {
+		panic(fmt.Sprintf("NewTipSet accepted an inconsistent block set (mutation %d)", int(mutation)%numTipSetMutations))
+	}
+
+	for _, b := range ts.Blocks() {
+		if b.Height != ts.Height() {
+			panic(fmt.Sprintf("block at height %d in tipset at height %d", b.Height, ts.Height()))
+		}
+	}
+	checkTipSetSorted(ts.Blocks())
+	checkTipSetKey(ts.Key())
+
+	// The key depends on the blocks, not on the order they were passed in
+	shuffled := append([]*types.BlockHeader{}, blks...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	ts1, err := types.NewTipSet(shuffled)
+	if err != nil {
+		panic(fmt.Sprintf("NewTipSet rejected a reordering of a valid block set: %v", err))
+	}
+	if ts1.Key() != ts.Key() {
+		panic(fmt.Sprintf("tipset key %s changed to %s when reordering the blocks", ts.Key(), ts1.Key()))
+	}
+
+	// And the tipset itself round-trips
+	buf := new(bytes.Buffer)
+	if err := ts.MarshalCBOR(buf); err != nil {
+		panic(fmt.Sprintf("Couldn't marshal a valid tipset: %v", err))
+	}
+	var ts2 types.TipSet
+	if err := ts2.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	if ts2.Key() != ts.Key() {
+		panic(fmt.Sprintf("CBOR round-trip of tipset %s gave %s", ts.Key(), ts2.Key()))
+	}
+	return 1
+}
+
+// Fuzzing TipSetKey from raw bytes, which must be a canonical concatenation of CIDs
+func FuzzTipSetKeyRaw(data []byte) int {
+	tsk, err := types.TipSetKeyFromBytes(data)
+	if err != nil {
+		return 0
+	}
+	// Re-encode from the parsed CIDs, tsk.Bytes() would just hand back the input
+	reencoded := types.NewTipSetKey(tsk.Cids()...).Bytes()
+	if !bytes.Equal(reencoded, data) {
+		fmt.Printf("input: %x\n", data)
+		fmt.Printf("reencoded: %x\n", reencoded)
+		panic("TipSetKeyFromBytes accepted a non-canonical encoding")
+	}
+	checkTipSetKey(tsk)
+	return 1
+}
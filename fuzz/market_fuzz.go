@@ -0,0 +1,374 @@
+// Stateful fuzzing of storage deal publication in the market actor
+// Deals are published, activated and terminated in the specs-actors mock runtime,
+// client signatures are checked by a local stub instead of real keys
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+var (
+	marketClients  = []goaddr.Address{mockrt.IDAddress(100), mockrt.IDAddress(101)}
+	marketProvider = mockrt.IDAddress(102)
+	marketWorker   = mockrt.IDAddress(103)
+	marketOwner    = mockrt.IDAddress(104)
+)
+
+// Upper bound on the deals in one PublishStorageDeals call
+const maxPublishDeals = 4
+
+const (
+	marketOpAddBalance = iota
+	marketOpPublish
+	marketOpActivate
+	marketOpTerminate
+	numMarketOps
+)
+
+// A deal as the fuzzer generates it, turned into a proposal by marketProposal
+type marketDeal struct {
+	Client     uint8
+	CommP      [32]byte
+	PieceSize  uint64
+	Start      uint16
+	Duration   int16
+	Price      uint16
+	ProvColl   uint16
+	ClientColl uint16
+	BadSig     bool
+	// Publish the same proposal as an earlier deal
+	Duplicate bool
+}
+
+// One step of a market scenario, the fields used depend on Kind
+type marketOp struct {
+	Kind    uint8
+	Party   uint8
+	Amount  uint32
+	Deals   []marketDeal
+	DealIDs []uint8
+	Expiry  uint16
+	// Publish from someone other than the provider's worker
+	NotWorker bool
+	Advance   uint8
+}
+
+func newMarketState() cbg.CBORUnmarshaler {
+	return new(market.State)
+}
+
+// sigStub is the signature the local verification stub accepts for a proposal
+func sigStub(raw []byte) crypto.Signature {
+	return crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: cidOf(raw).Bytes()}
+}
+
+// expectControlAddrs answers the market's query for the provider's control addresses
+func expectControlAddrs(rt *mockrt.Runtime) {
+	rt.ExpectSend(marketProvider, builtin.MethodsMiner.ControlAddresses, nil, big.Zero(),
+		&miner.GetControlAddressesReturn{Owner: marketOwner, Worker: marketWorker}, exitcode.Ok)
+}
+
+// marketProposal builds the proposal for d, valid says whether it breaks none of the
+// rules the harness checks for
+func marketProposal(d marketDeal, epoch abi.ChainEpoch) (market.DealProposal, bool) {
+	piece, err := commcid.PieceCommitmentV1ToCID(d.CommP[:])
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create piece CID: %v", err))
+	}
+	p := market.DealProposal{
+		PieceCID:             piece,
+		PieceSize:            abi.PaddedPieceSize(d.PieceSize),
+		Client:               marketClients[int(d.Client)%len(marketClients)],
+		Provider:             marketProvider,
+		StartEpoch:           epoch + abi.ChainEpoch(d.Start),
+		StoragePricePerEpoch: abi.NewTokenAmount(int64(d.Price)),
+		ProviderCollateral:   abi.NewTokenAmount(int64(d.ProvColl)),
+		ClientCollateral:     abi.NewTokenAmount(int64(d.ClientColl)),
+	}
+	p.EndEpoch = p.StartEpoch + abi.ChainEpoch(d.Duration)
+	valid := p.PieceSize.Validate() == nil && p.EndEpoch > p.StartEpoch && !d.BadSig
+	return p, valid
+}
+
+// balanceTable reads an escrow or locked table
+func balanceTable(rt *mockrt.Runtime, root cid.Cid) map[goaddr.Address]abi.TokenAmount {
+	m, err := adt.AsMap(adt.AsStore(rt), root)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load balance table: %v", err))
+	}
+	out := make(map[goaddr.Address]abi.TokenAmount)
+	var v abi.TokenAmount
+	err = m.ForEach(&v, func(k string) error {
+		a, err := goaddr.NewFromBytes([]byte(k))
+		if err != nil {
+			return err
+		}
+		out[a] = v
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read balance table: %v", err))
+	}
+	return out
+}
+
+// checkMarketBalances checks the escrow adds up to what was deposited and covers the locked amounts
+func checkMarketBalances(rt *mockrt.Runtime, st *market.State, deposited, locked abi.TokenAmount) {
+	escrow := balanceTable(rt, st.EscrowTable)
+	lockedTable := balanceTable(rt, st.LockedTable)
+	total, totalLocked := big.Zero(), big.Zero()
+	for a, e := range escrow {
+		if e.LessThan(big.Zero()) {
+			panic(fmt.Sprintf("negative escrow %s for %s", e, a))
+		}
+		total = big.Add(total, e)
+	}
+	for a, l := range lockedTable {
+		if l.LessThan(big.Zero()) {
+			panic(fmt.Sprintf("negative locked balance %s for %s", l, a))
+		}
+		e, ok := escrow[a]
+		if !ok || l.GreaterThan(e) {
+			panic(fmt.Sprintf("%s locked for %s with %s in escrow", l, a, e))
+		}
+		totalLocked = big.Add(totalLocked, l)
+	}
+	if !total.Equals(deposited) {
+		panic(fmt.Sprintf("escrow adds up to %s, %s was deposited", total, deposited))
+	}
+	if !totalLocked.Equals(locked) {
+		panic(fmt.Sprintf("locked balances add up to %s, published deals require %s", totalLocked, locked))
+	}
+}
+
+// dealState reads the state of a deal, nil if it isn't activated
+func dealState(rt *mockrt.Runtime, st *market.State, id abi.DealID) *market.DealState {
+	states, err := adt.AsArray(adt.AsStore(rt), st.States)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load deal states: %v", err))
+	}
+	var ds market.DealState
+	found, err := states.Get(uint64(id), &ds)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read deal state %d: %v", id, err))
+	}
+	if !found {
+		return nil
+	}
+	return &ds
+}
+
+// Fuzzing deal publication, activation and termination in the market actor
+// Escrow has to add up to the deposits, locked balances to what the published deals
+// require, and deals with bad piece sizes, bad signatures, an end not after their start,
+// or a proposal already published must never be accepted
+func FuzzMarketDeals(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var ops []marketOp
+	f.Fuzz(&ops)
+	if len(ops) > maxScenarioSteps {
+		ops = ops[:maxScenarioSteps]
+	}
+
+	rt := mockrt.NewRuntime(builtin.StorageMarketActorAddr, 0, big.Zero())
+	for _, c := range marketClients {
+		rt.SetAddressActorType(c, builtin.AccountActorCodeID)
+	}
+	rt.SetAddressActorType(marketWorker, builtin.AccountActorCodeID)
+	rt.SetAddressActorType(marketOwner, builtin.AccountActorCodeID)
+	rt.SetAddressActorType(marketProvider, builtin.StorageMinerActorCodeID)
+	actor := market.Actor{}
+	if !construct(rt, actor.Exports(), systemCaller, expectAddr(builtin.SystemActorAddr), zeroParams(actor.Constructor)) {
+		return 0
+	}
+
+	var st market.State
+	deposited, locked := big.Zero(), big.Zero()
+	published := make(map[abi.DealID]market.DealProposal)
+	// in publication order, map iteration would make inputs non-reproducible
+	var publishedIDs []abi.DealID
+	proposals := make(map[cid.Cid]bool)
+	epoch := abi.ChainEpoch(0)
+	for _, op := range ops {
+		epoch += abi.ChainEpoch(op.Advance)
+		rt.SetEpoch(epoch)
+		rt.GetState(&st)
+
+		switch int(op.Kind) % numMarketOps {
+		case marketOpAddBalance:
+			amount := abi.NewTokenAmount(int64(op.Amount))
+			rt.SetReceived(amount)
+			rt.SetBalance(big.Add(deposited, amount))
+			nominal := marketProvider
+			rt.ExpectValidateCallerType(builtin.CallerTypesSignable...)
+			if i := int(op.Party) % (len(marketClients) + 1); i < len(marketClients) {
+				nominal = marketClients[i]
+				rt.SetCaller(nominal, builtin.AccountActorCodeID)
+			} else {
+				rt.SetCaller(marketOwner, builtin.AccountActorCodeID)
+				expectControlAddrs(rt)
+				rt.ExpectValidateCallerAddr(marketOwner, marketWorker)
+			}
+			res := mockrt.InvokeReverting(rt, newMarketState, actor.AddBalance, &nominal)
+			rt.SetReceived(big.Zero())
+			if res.MockFailure {
+				return 0
+			}
+			if !res.Aborted {
+				deposited = big.Add(deposited, amount)
+			}
+			rt.SetBalance(deposited)
+
+		case marketOpPublish:
+			if len(op.Deals) == 0 {
+				continue
+			}
+			if len(op.Deals) > maxPublishDeals {
+				op.Deals = op.Deals[:maxPublishDeals]
+			}
+			params := &market.PublishStorageDealsParams{}
+			valid := true
+			batch := make(map[cid.Cid]bool)
+			required := big.Zero()
+			for _, d := range op.Deals {
+				p, ok := marketProposal(d, epoch)
+				if d.Duplicate && len(publishedIDs) > 0 {
+					p = published[publishedIDs[int(d.Client)%len(publishedIDs)]]
+					ok = !d.BadSig
+				}
+				pc, err := p.Cid()
+				if err != nil {
+					return 0
+				}
+				valid = valid && ok && !proposals[pc] && !batch[pc]
+				batch[pc] = true
+				required = big.Add(required, big.Add(p.ClientBalanceRequirement(), p.ProviderBalanceRequirement()))
+
+				buf := new(bytes.Buffer)
+				if err := p.MarshalCBOR(buf); err != nil {
+					return 0
+				}
+				sig := sigStub(buf.Bytes())
+				var sigErr error
+				if d.BadSig {
+					sig.Data = append(sig.Data, 0)
+					sigErr = fmt.Errorf("bad signature")
+				}
+				rt.ExpectVerifySignature(sig, p.Client, buf.Bytes(), sigErr)
+				params.Deals = append(params.Deals, market.ClientDealProposal{Proposal: p, ClientSignature: sig})
+			}
+			caller := marketWorker
+			if op.NotWorker {
+				caller = marketOwner
+			}
+			rt.SetCaller(caller, builtin.AccountActorCodeID)
+			rt.ExpectValidateCallerType(builtin.CallerTypesSignable...)
+			expectControlAddrs(rt)
+			nextID := st.NextID
+			res := mockrt.InvokeReverting(rt, newMarketState, actor.PublishStorageDeals, params)
+			if res.MockFailure {
+				return 0
+			}
+			if res.Aborted {
+				break
+			}
+			if !valid {
+				fmt.Printf("deals: %#v\n", params.Deals)
+				panic("PublishStorageDeals accepted an invalid or duplicate deal")
+			}
+			if op.NotWorker {
+				panic("PublishStorageDeals accepted deals not sent by the provider's worker")
+			}
+			ret := res.Ret.(*market.PublishStorageDealsReturn)
+			if len(ret.IDs) != len(params.Deals) {
+				panic(fmt.Sprintf("%d deals published, %d ids returned", len(params.Deals), len(ret.IDs)))
+			}
+			for i, id := range ret.IDs {
+				if id != nextID+abi.DealID(i) {
+					panic(fmt.Sprintf("deal id %d returned, expected %d", id, nextID+abi.DealID(i)))
+				}
+				published[id] = params.Deals[i].Proposal
+				publishedIDs = append(publishedIDs, id)
+			}
+			for c := range batch {
+				proposals[c] = true
+			}
+			locked = big.Add(locked, required)
+
+		case marketOpActivate, marketOpTerminate:
+			var ids []abi.DealID
+			for _, i := range op.DealIDs {
+				ids = append(ids, abi.DealID(int(i)%(int(st.NextID)+1)))
+			}
+			var before []*market.DealState
+			for _, id := range ids {
+				before = append(before, dealState(rt, &st, id))
+			}
+			rt.SetCaller(marketProvider, builtin.StorageMinerActorCodeID)
+			rt.ExpectValidateCallerType(builtin.StorageMinerActorCodeID)
+			activate := int(op.Kind)%numMarketOps == marketOpActivate
+			var res mockrt.Result
+			if activate {
+				res = mockrt.InvokeReverting(rt, newMarketState, actor.VerifyDealsOnSectorProveCommit,
+					&market.VerifyDealsOnSectorProveCommitParams{DealIDs: ids, SectorExpiry: epoch + abi.ChainEpoch(op.Expiry)})
+			} else {
+				res = mockrt.InvokeReverting(rt, newMarketState, actor.OnMinerSectorsTerminate,
+					&market.OnMinerSectorsTerminateParams{DealIDs: ids})
+			}
+			if res.MockFailure {
+				return 0
+			}
+			if res.Aborted {
+				break
+			}
+			rt.GetState(&st)
+			for i, id := range ids {
+				p, ok := published[id]
+				if !ok {
+					panic(fmt.Sprintf("deal %d was never published", id))
+				}
+				ds := dealState(rt, &st, id)
+				if activate {
+					if ds == nil {
+						panic(fmt.Sprintf("deal %d not active after a successful activation", id))
+					}
+					if before[i] != nil {
+						panic(fmt.Sprintf("deal %d activated twice", id))
+					}
+					if epoch > p.StartEpoch {
+						panic(fmt.Sprintf("deal %d activated at %d, after its start %d", id, epoch, p.StartEpoch))
+					}
+					if epoch+abi.ChainEpoch(op.Expiry) < p.EndEpoch {
+						panic(fmt.Sprintf("deal %d ending at %d activated in a sector expiring at %d", id, p.EndEpoch, epoch+abi.ChainEpoch(op.Expiry)))
+					}
+					if ds.SectorStartEpoch != epoch {
+						panic(fmt.Sprintf("deal %d activated at %d records %d", id, epoch, ds.SectorStartEpoch))
+					}
+				} else if ds != nil && ds.SlashEpoch == -1 && epoch < p.EndEpoch {
+					panic(fmt.Sprintf("deal %d not slashed by a termination at %d", id, epoch))
+				}
+			}
+		}
+
+		rt.GetState(&st)
+		checkMarketBalances(rt, &st, deposited, locked)
+	}
+	return 1
+}
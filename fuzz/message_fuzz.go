@@ -0,0 +1,168 @@
+// Identity invariants of messages the mempool and chain rely on
+// A message has exactly one CID, the hash of its canonical encoding, so a
+// non-canonical encoding that decodes would give one message two CIDs
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+)
+
+// cidOf hashes raw the way Lotus builds message and block CIDs
+func cidOf(raw []byte) cid.Cid {
+	c, err := abi.CidBuilder.Sum(raw)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create CID: %v", err))
+	}
+	return c
+}
+
+// checkChainMsg checks the ChainMsg interface agrees with itself
+func checkChainMsg(m types.ChainMsg) {
+	blk, err := m.ToStorageBlock()
+	if err != nil {
+		panic(fmt.Sprintf("ToStorageBlock failed on a decoded message: %v", err))
+	}
+	if !blk.Cid().Equals(m.Cid()) {
+		panic(fmt.Sprintf("ToStorageBlock CID %s differs from Cid() %s", blk.Cid(), m.Cid()))
+	}
+	if !cidOf(blk.RawData()).Equals(blk.Cid()) {
+		panic(fmt.Sprintf("storage block %s doesn't hash to its CID", blk.Cid()))
+	}
+}
+
+// checkMessageIdentity checks a Message decoded from raw
+func checkMessageIdentity(msg *types.Message, raw []byte) {
+	if !msg.Cid().Equals(cidOf(raw)) {
+		fmt.Printf("input: %x\n", raw)
+		panic("decoded Message has a different CID from its encoding, non-canonical input accepted")
+	}
+	if vm := msg.VMMessage(); vm != msg {
+		panic("Message.VMMessage isn't the message itself")
+	}
+	if msg.ChainLength() != len(raw) {
+		panic(fmt.Sprintf("ChainLength %d differs from the %d byte encoding", msg.ChainLength(), len(raw)))
+	}
+	checkChainMsg(msg)
+}
+
+// checkSignedMessageIdentity checks a SignedMessage decoded from raw
+func checkSignedMessageIdentity(smsg *types.SignedMessage, raw []byte) {
+	if smsg.Signature.Type == crypto.SigTypeBLS {
+		// BLS messages are aggregated in the block, so they're identified by the bare message
+		if !smsg.Cid().Equals(smsg.Message.Cid()) {
+			panic(fmt.Sprintf("BLS SignedMessage CID %s differs from its Message CID %s", smsg.Cid(), smsg.Message.Cid()))
+		}
+	} else {
+		if !smsg.Cid().Equals(cidOf(raw)) {
+			fmt.Printf("input: %x\n", raw)
+			panic("decoded SignedMessage has a different CID from its encoding, non-canonical input accepted")
+		}
+		if smsg.Cid().Equals(smsg.Message.Cid()) {
+			panic("secp SignedMessage shares its CID with the unsigned Message")
+		}
+		// secp messages are stored signed, so gas is charged on the full encoding
+		// Lotus has changed what BLS messages are charged on, so that isn't pinned here
+		if smsg.ChainLength() != len(raw) {
+			panic(fmt.Sprintf("ChainLength %d differs from the %d byte encoding", smsg.ChainLength(), len(raw)))
+		}
+	}
+	if !smsg.VMMessage().Cid().Equals(smsg.Message.Cid()) {
+		panic("SignedMessage.VMMessage isn't the signed message")
+	}
+	checkChainMsg(smsg)
+
+	msgRaw, err := smsg.Message.Serialize()
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't serialize the inner Message: %v", err))
+	}
+	checkMessageIdentity(&smsg.Message, msgRaw)
+}
+
+// Fuzzing Message CID invariants from raw byteslice
+func FuzzMessageCidRaw(data []byte) int {
+	msg, err := types.DecodeMessage(data)
+	if err != nil {
+		return 0
+	}
+	checkMessageIdentity(msg, data)
+	return 1
+}
+
+// Fuzzing SignedMessage CID invariants from raw byteslice
+func FuzzSignedMessageCidRaw(data []byte) int {
+	smsg, err := types.DecodeSignedMessage(data)
+	if err != nil {
+		return 0
+	}
+	checkSignedMessageIdentity(smsg, data)
+	return 1
+}
+
+// Fields gofuzz can't fill in a way that serializes
+type messageCidInput struct {
+	To, From   uint64
+	Value      uint64
+	GasPrice   uint64
+	MessageRaw types.Message
+	Signature  []byte
+}
+
+// Fuzzing Message and SignedMessage CID invariants from a generated struct
+// The same message signed with either signature type has to keep its Message CID
+func FuzzMessageCidStructured(data []byte) int {
+	var in messageCidInput
+	gfuzz.NewFromGoFuzz(data).NilChance(0).Fuzz(&in)
+
+	msg := in.MessageRaw
+	var err error
+	if msg.To, err = goaddr.NewIDAddress(in.To); err != nil {
+		return 0
+	}
+	if msg.From, err = goaddr.NewIDAddress(in.From); err != nil {
+		return 0
+	}
+	msg.Value = types.NewInt(in.Value)
+	msg.GasPrice = types.NewInt(in.GasPrice)
+
+	raw, err := msg.Serialize()
+	if err != nil {
+		return 0
+	}
+	decoded, err := types.DecodeMessage(raw)
+	if err != nil {
+		panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+	}
+	checkMessageIdentity(decoded, raw)
+
+	for _, typ := range []crypto.SigType{crypto.SigTypeSecp256k1, crypto.SigTypeBLS} {
+		smsg := &types.SignedMessage{
+			Message:   msg,
+			Signature: crypto.Signature{Type: typ, Data: in.Signature},
+		}
+		sraw, err := smsg.Serialize()
+		if err != nil {
+			return 0
+		}
+		sdecoded, err := types.DecodeSignedMessage(sraw)
+		if err != nil {
+			panic(fmt.Sprintf("should be able to unmarshal something we made. Err: %v", err))
+		}
+		if !bytes.Equal(sdecoded.Signature.Data, in.Signature) {
+			panic("signature bytes changed in a SignedMessage round-trip")
+		}
+		checkSignedMessageIdentity(sdecoded, sraw)
+		if !sdecoded.Message.Cid().Equals(decoded.Cid()) {
+			panic(fmt.Sprintf("signing with type %d changed the Message CID", typ))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,553 @@
+// Stateful fuzzing of miner PoSt and fault handling
+// The miner runs on mockrt.Runtime across fuzzed epochs, with a fake proof verifier.
+// Its calls to power go to the power actor on a runtime of its own, which the power
+// the miner claims is checked against. Reward and market are faked. Cron events are
+// delivered by the harness rather than by ticking power, the mock runtime can't take
+// the miner calling back into power while power is calling it
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	init_ "github.com/filecoin-project/specs-actors/actors/builtin/init"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+var (
+	minerAddr   = mockrt.IDAddress(102)
+	minerWorker = mockrt.IDAddress(103)
+	minerOwner  = mockrt.IDAddress(104)
+)
+
+// Proof bytes the fake verifier accepts
+var validProof = []byte("valid")
+
+// Upper bound on the sectors put in the miner before the scenario starts
+const maxMinerSectors = 64
+
+// Largest sector number looked for in a bitfield
+const maxSectorNumber = 1 << 20
+
+const minerSealProof = abi.RegisteredProof_StackedDRG2KiBSeal
+
+const (
+	minerOpPoSt = iota
+	minerOpDeclareFaults
+	minerOpDeclareRecovered
+	minerOpTerminate
+	minerOpExtend
+	minerOpCron
+	numMinerOps
+)
+
+// One step of a miner scenario, the fields used depend on Kind
+type minerOp struct {
+	Kind uint8
+	// Use the deadline the first sector is due in rather than Deadline
+	OwnDeadline bool
+	Deadline    uint8
+	Partitions  []uint8
+	// Indexes into the sectors put in the miner
+	Sectors    []uint8
+	Skipped    []uint8
+	BadProof   bool
+	Expiration uint16
+	Advance    uint16
+}
+
+func newMinerState() cbg.CBORUnmarshaler {
+	return new(miner.State)
+}
+
+// A cron event the miner enrolled with the fake power actor
+type minerCronEvent struct {
+	epoch   abi.ChainEpoch
+	payload []byte
+}
+
+// sendRet turns what an actor method returned into what a send hands back
+func sendRet(ret interface{}) vmr.CBORMarshaler {
+	if v := reflect.ValueOf(ret); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil
+	}
+	m, ok := ret.(vmr.CBORMarshaler)
+	if !ok {
+		panic(fmt.Sprintf("Bug in harness, actor method returned %T", ret))
+	}
+	return m
+}
+
+// forward hands a send from the actor at from to the actor running on callee, through
+// the params encoding as the VM does. The callee's state and balance are rolled back
+// if it aborts. Anything the callee does that the harness didn't model is a harness bug
+func forward(callee *mockrt.Runtime, exports []interface{}, newState func() cbg.CBORUnmarshaler, from actorRef, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	if int(method) >= len(exports) || exports[method] == nil {
+		return nil, exitcode.SysErrInvalidMethod
+	}
+	var p interface{}
+	if params == nil {
+		p = zeroParams(exports[method])
+	} else {
+		buf := new(bytes.Buffer)
+		if err := params.MarshalCBOR(buf); err != nil {
+			panic(fmt.Sprintf("Couldn't encode params of method %d: %v", method, err))
+		}
+		var ok bool
+		if p, ok = decodeParams(exports[method], buf.Bytes()); !ok {
+			return nil, exitcode.ErrSerialization
+		}
+	}
+
+	balance := callee.Balance
+	callee.SetCaller(from.addr, from.code)
+	callee.SetReceived(value)
+	callee.SetBalance(big.Add(balance, value))
+	res := mockrt.InvokeReverting(callee, newState, exports[method], p)
+	callee.SetReceived(big.Zero())
+	if res.MockFailure {
+		panic(fmt.Sprintf("Bug in harness, method %d called by %s did something the harness doesn't model", method, from.addr))
+	}
+	if res.Aborted {
+		callee.SetBalance(balance)
+		return nil, res.Code
+	}
+	return sendRet(res.Ret), exitcode.Ok
+}
+
+// minerPeers fakes the reward and market actors the miner talks to, and hands its calls
+// to power to the power actor
+type minerPeers struct {
+	power     *mockrt.Runtime
+	cron      []minerCronEvent
+	workerKey goaddr.Address
+}
+
+func newMinerPowerState() cbg.CBORUnmarshaler {
+	return new(power.State)
+}
+
+// powerSend answers the sends the power actor makes. The only one expected is the
+// Exec creating the miner, which is constructed by the harness
+func (p *minerPeers) powerSend(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	if to == builtin.InitActorAddr && method == builtin.MethodsInit.Exec {
+		robust, err := goaddr.NewActorAddress(minerAddr.Bytes())
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+		}
+		return &init_.ExecReturn{IDAddress: minerAddr, RobustAddress: robust}, exitcode.Ok
+	}
+	panic(fmt.Sprintf("power sent method %d to %s, which the fakes don't model", method, to))
+}
+
+// invoke calls the miner, rolling back the power actor and the enrolled cron events with
+// the miner's state if it aborts, as the VM would
+func (p *minerPeers) invoke(rt *mockrt.Runtime, method interface{}, params interface{}) mockrt.Result {
+	cron := append([]minerCronEvent(nil), p.cron...)
+	var powerSt power.State
+	p.power.GetState(&powerSt)
+	powerBalance := p.power.Balance
+	res := mockrt.InvokeReverting(rt, newMinerState, method, params)
+	if res.Aborted {
+		p.cron = cron
+		p.power.ReplaceState(&powerSt)
+		p.power.SetBalance(powerBalance)
+	}
+	return res
+}
+
+// claim reads the miner's claim from the power actor's state
+func (p *minerPeers) claim() power.Claim {
+	var st power.State
+	p.power.GetState(&st)
+	claims, err := adt.AsMap(adt.AsStore(p.power), st.Claims)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load claims: %v", err))
+	}
+	var c power.Claim
+	found, err := claims.Get(adt.AddrKey(minerAddr), &c)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read claim: %v", err))
+	}
+	if !found {
+		panic(fmt.Sprintf("power has no claim for miner %s", minerAddr))
+	}
+	return c
+}
+
+func (p *minerPeers) send(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	switch {
+	case to == minerWorker && method == builtin.MethodsAccount.PubkeyAddress:
+		return &p.workerKey, exitcode.Ok
+	case to == builtin.RewardActorAddr && method == builtin.MethodsReward.LastPerEpochReward:
+		r := abi.NewTokenAmount(1e9)
+		return &r, exitcode.Ok
+	case to == builtin.StoragePowerActorAddr:
+		ret, code := forward(p.power, power.Actor{}.Exports(), newMinerPowerState, actorRef{minerAddr, builtin.StorageMinerActorCodeID}, method, params, value)
+		// power only queues the event, the harness delivers it
+		if code == exitcode.Ok && method == builtin.MethodsPower.EnrollCronEvent {
+			ev := params.(*power.EnrollCronEventParams)
+			p.cron = append(p.cron, minerCronEvent{epoch: ev.EventEpoch, payload: ev.Payload})
+		}
+		return ret, code
+	case to == builtin.StorageMarketActorAddr && method == builtin.MethodsMarket.OnMinerSectorsTerminate:
+		return nil, exitcode.Ok
+	case to == builtin.StorageMarketActorAddr && method == builtin.MethodsMarket.VerifyDealsOnSectorProveCommit:
+		return &market.VerifyDealsOnSectorProveCommitReturn{DealWeight: big.Zero(), VerifiedDealWeight: big.Zero()}, exitcode.Ok
+	case to == builtin.BurntFundsActorAddr || to == minerOwner:
+		return nil, exitcode.Ok
+	}
+	panic(fmt.Sprintf("miner sent method %d to %s, which the fakes don't model", method, to))
+}
+
+// fakeVerifyPoSt accepts a PoSt when every proof is validProof
+func fakeVerifyPoSt(info abi.WindowPoStVerifyInfo) error {
+	if len(info.Proofs) == 0 {
+		return fmt.Errorf("no proofs")
+	}
+	for _, p := range info.Proofs {
+		if !bytes.Equal(p.ProofBytes, validProof) {
+			return fmt.Errorf("invalid proof")
+		}
+	}
+	return nil
+}
+
+// bitSetOf lists a bitfield as a set
+func bitSetOf(bf *abi.BitField) map[uint64]bool {
+	out := make(map[uint64]bool)
+	if bf == nil {
+		return out
+	}
+	all, err := bf.All(maxSectorNumber)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read bitfield: %v", err))
+	}
+	for _, i := range all {
+		out[i] = true
+	}
+	return out
+}
+
+// minerSectors lists the sectors in the miner's state
+func minerSectors(rt *mockrt.Runtime, st *miner.State) map[uint64]bool {
+	out := make(map[uint64]bool)
+	err := st.ForEachSector(adt.AsStore(rt), func(info *miner.SectorOnChainInfo) {
+		out[uint64(info.Info.SectorNumber)] = true
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read sectors: %v", err))
+	}
+	return out
+}
+
+// checkMinerState checks the sector bookkeeping and that the raw power the power actor
+// credits the miner with matches its sectors that aren't faulty
+func checkMinerState(rt *mockrt.Runtime, st *miner.State, claimed abi.StoragePower) {
+	sectors := minerSectors(rt, st)
+	faults := bitSetOf(st.Faults)
+	for s := range faults {
+		if !sectors[s] {
+			panic(fmt.Sprintf("fault on sector %d which doesn't exist", s))
+		}
+	}
+	for s := range bitSetOf(st.Recoveries) {
+		if !faults[s] {
+			panic(fmt.Sprintf("sector %d recovering but not faulty", s))
+		}
+	}
+
+	deadlines, err := st.LoadDeadlines(adt.AsStore(rt))
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load deadlines: %v", err))
+	}
+	due := make(map[uint64]int)
+	for d, bf := range deadlines.Due {
+		for s := range bitSetOf(bf) {
+			if prev, ok := due[s]; ok {
+				panic(fmt.Sprintf("sector %d due at deadlines %d and %d", s, prev, d))
+			}
+			if !sectors[s] {
+				panic(fmt.Sprintf("sector %d due at deadline %d doesn't exist", s, d))
+			}
+			due[s] = d
+		}
+	}
+
+	active := int64(len(sectors) - len(faults))
+	expected := big.Mul(big.NewInt(active), big.NewInt(int64(st.Info.SectorSize)))
+	if !claimed.Equals(expected) {
+		panic(fmt.Sprintf("power credits the miner with %s raw power for %d active sectors of %d bytes", claimed, active, st.Info.SectorSize))
+	}
+}
+
+// plantSectors puts n committed sectors straight in the miner's state, as if they were
+// proven before the scenario, and credits them with power through the miner's OnSend
+// the way ProveCommitSector would. They count as activated at epoch 0
+func plantSectors(rt *mockrt.Runtime, n int, expiration abi.ChainEpoch) []abi.SectorNumber {
+	var st miner.State
+	rt.GetState(&st)
+	store := adt.AsStore(rt)
+	var nums []abi.SectorNumber
+	var numsRaw []uint64
+	for i := 0; i < n; i++ {
+		var commR [32]byte
+		commR[0] = byte(i)
+		sealed, err := commcid.ReplicaCommitmentV1ToCID(commR[:])
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't create sealed CID: %v", err))
+		}
+		info := &miner.SectorOnChainInfo{
+			Info: miner.SectorPreCommitInfo{
+				RegisteredProof: minerSealProof,
+				SectorNumber:    abi.SectorNumber(i),
+				SealedCID:       sealed,
+				Expiration:      expiration,
+			},
+			DealWeight:         big.Zero(),
+			VerifiedDealWeight: big.Zero(),
+		}
+		if err := st.PutSector(store, info); err != nil {
+			panic(fmt.Sprintf("Couldn't put sector: %v", err))
+		}
+		if err := st.AddSectorExpirations(store, info.Info.Expiration, uint64(i)); err != nil {
+			panic(fmt.Sprintf("Couldn't add sector expiration: %v", err))
+		}
+		nums = append(nums, abi.SectorNumber(i))
+		numsRaw = append(numsRaw, uint64(i))
+		_, code := rt.OnSend(builtin.StoragePowerActorAddr, builtin.MethodsPower.OnSectorProveCommit, &power.OnSectorProveCommitParams{
+			Weight: power.SectorStorageWeightDesc{
+				SectorSize:         st.Info.SectorSize,
+				Duration:           info.Info.Expiration,
+				DealWeight:         info.DealWeight,
+				VerifiedDealWeight: info.VerifiedDealWeight,
+			},
+		}, big.Zero())
+		if code != exitcode.Ok {
+			panic(fmt.Sprintf("Bug in harness, power rejected a committed sector with %d", code))
+		}
+	}
+	deadlines, err := st.LoadDeadlines(store)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load deadlines: %v", err))
+	}
+	if err := miner.AssignNewSectors(deadlines, st.Info.WindowPoStPartitionSectors, numsRaw, rt.GetRandomness(0, 0, nil)); err != nil {
+		panic(fmt.Sprintf("Couldn't assign sectors: %v", err))
+	}
+	if err := st.SaveDeadlines(store, deadlines); err != nil {
+		panic(fmt.Sprintf("Couldn't save deadlines: %v", err))
+	}
+	rt.ReplaceState(&st)
+	return nums
+}
+
+// sectorsBitField collects the fuzzed sector indexes into a bitfield
+func sectorsBitField(nums []abi.SectorNumber, idx []uint8) *abi.BitField {
+	set := make([]uint64, 0, len(idx))
+	for _, i := range idx {
+		set = append(set, uint64(nums[int(i)%len(nums)]))
+	}
+	return bitfield.NewFromSet(set)
+}
+
+// Fuzzing window PoSt, fault declaration, recovery, termination and extension on a miner
+// with sectors already committed, driven across proving periods with deferred cron events
+func FuzzMinerScenario(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var nSectors uint8
+	var expiry uint16
+	var ops []minerOp
+	f.Fuzz(&nSectors)
+	f.Fuzz(&expiry)
+	f.Fuzz(&ops)
+	if len(ops) > maxScenarioSteps {
+		ops = ops[:maxScenarioSteps]
+	}
+
+	rt := mockrt.NewRuntime(minerAddr, 0, abi.NewTokenAmount(1e18))
+	rt.SetAddressActorType(minerWorker, builtin.AccountActorCodeID)
+	rt.SetAddressActorType(minerOwner, builtin.AccountActorCodeID)
+	var workerKey [48]byte
+	key, err := goaddr.NewBLSAddress(workerKey[:])
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+	}
+	peers := &minerPeers{workerKey: key}
+	rt.OnSend = peers.send
+	rt.VerifyPoSt = fakeVerifyPoSt
+
+	// Power comes first, the miner is created through it and enrolls with it when constructed
+	peers.power = mockrt.NewRuntime(builtin.StoragePowerActorAddr, 0, big.Zero())
+	peers.power.OnSend = peers.powerSend
+	peers.power.ValidateCallers = true
+	peers.power.SetAddressActorType(minerOwner, builtin.AccountActorCodeID)
+	peers.power.SetAddressActorType(minerAddr, builtin.StorageMinerActorCodeID)
+	powerActor := power.Actor{}
+	if !construct(peers.power, powerActor.Exports(), systemCaller, nil, (*adt.EmptyValue)(nil)) {
+		panic("Bug in harness, couldn't construct the power actor")
+	}
+	peers.power.SetCaller(minerOwner, builtin.AccountActorCodeID)
+	res := mockrt.InvokeReverting(peers.power, newMinerPowerState, powerActor.CreateMiner, &power.CreateMinerParams{
+		Owner:         minerOwner,
+		Worker:        minerWorker,
+		SealProofType: minerSealProof,
+		Peer:          []byte("peer"),
+	})
+	if res.MockFailure || res.Aborted {
+		panic(fmt.Sprintf("Bug in harness, couldn't create the miner in power: %d", res.Code))
+	}
+
+	actor := miner.Actor{}
+	rt.SetCaller(builtin.InitActorAddr, builtin.InitActorCodeID)
+	rt.ExpectValidateCallerAddr(builtin.InitActorAddr)
+	res = peers.invoke(rt, actor.Constructor, &power.MinerConstructorParams{
+		OwnerAddr:     minerOwner,
+		WorkerAddr:    minerWorker,
+		SealProofType: minerSealProof,
+		PeerId:        []byte("peer"),
+	})
+	if res.MockFailure || res.Aborted {
+		return 0
+	}
+
+	nums := plantSectors(rt, int(nSectors)%maxMinerSectors+1, abi.ChainEpoch(expiry)+miner.WPoStProvingPeriod)
+	var st miner.State
+	rt.GetState(&st)
+	checkMinerState(rt, &st, peers.claim().RawBytePower)
+
+	epoch := abi.ChainEpoch(0)
+	for _, op := range ops {
+		epoch += abi.ChainEpoch(op.Advance) % miner.WPoStProvingPeriod
+		rt.SetEpoch(epoch)
+		peers.power.SetEpoch(epoch)
+		rt.GetState(&st)
+		deadline := uint64(op.Deadline) % miner.WPoStPeriodDeadlines
+		if op.OwnDeadline && len(op.Sectors) > 0 {
+			first := uint64(nums[int(op.Sectors[0])%len(nums)])
+			deadlines, err := st.LoadDeadlines(adt.AsStore(rt))
+			if err != nil {
+				panic(fmt.Sprintf("Couldn't load deadlines: %v", err))
+			}
+			for d, bf := range deadlines.Due {
+				if bitSetOf(bf)[first] {
+					deadline = uint64(d)
+				}
+			}
+		}
+		prevRecoveries := bitSetOf(st.Recoveries)
+
+		rt.SetCaller(minerWorker, builtin.AccountActorCodeID)
+		rt.ExpectValidateCallerAddr(minerWorker)
+		switch int(op.Kind) % numMinerOps {
+		case minerOpPoSt:
+			deadline = st.DeadlineInfo(epoch).Index
+			params := &miner.SubmitWindowedPoStParams{
+				Deadline: deadline,
+				Proofs:   []abi.PoStProof{{RegisteredProof: abi.RegisteredProof_StackedDRG2KiBWindowPoSt, ProofBytes: validProof}},
+				Skipped:  *sectorsBitField(nums, op.Skipped),
+			}
+			if op.BadProof {
+				params.Proofs[0].ProofBytes = []byte("invalid")
+			}
+			for _, p := range op.Partitions {
+				params.Partitions = append(params.Partitions, uint64(p%4))
+			}
+			res = peers.invoke(rt, actor.SubmitWindowedPoSt, params)
+			if res.MockFailure {
+				return 0
+			}
+			if !res.Aborted {
+				if op.BadProof {
+					panic("SubmitWindowedPoSt accepted a proof the verifier rejected")
+				}
+				rt.GetState(&st)
+				deadlines, err := st.LoadDeadlines(adt.AsStore(rt))
+				if err != nil {
+					panic(fmt.Sprintf("Couldn't load deadlines: %v", err))
+				}
+				partitions, err := miner.ComputePartitionsSectors(deadlines, st.Info.WindowPoStPartitionSectors, deadline, params.Partitions)
+				if err != nil {
+					panic(fmt.Sprintf("Couldn't compute partitions of an accepted PoSt: %v", err))
+				}
+				skipped := bitSetOf(&params.Skipped)
+				faults := bitSetOf(st.Faults)
+				for _, bf := range partitions {
+					for s := range bitSetOf(bf) {
+						if prevRecoveries[s] && !skipped[s] && faults[s] {
+							panic(fmt.Sprintf("sector %d proven recovered but still faulty", s))
+						}
+					}
+				}
+			}
+		case minerOpDeclareFaults:
+			res = peers.invoke(rt, actor.DeclareFaults, &miner.DeclareFaultsParams{
+				Faults: []miner.FaultDeclaration{{Deadline: deadline, Sectors: sectorsBitField(nums, op.Sectors)}},
+			})
+		case minerOpDeclareRecovered:
+			res = peers.invoke(rt, actor.DeclareFaultsRecovered, &miner.DeclareFaultsRecoveredParams{
+				Recoveries: []miner.RecoveryDeclaration{{Deadline: deadline, Sectors: sectorsBitField(nums, op.Sectors)}},
+			})
+		case minerOpTerminate:
+			res = peers.invoke(rt, actor.TerminateSectors, &miner.TerminateSectorsParams{
+				Sectors: sectorsBitField(nums, op.Sectors),
+			})
+		case minerOpExtend:
+			if len(op.Sectors) == 0 {
+				continue
+			}
+			res = peers.invoke(rt, actor.ExtendSectorExpiration, &miner.ExtendSectorExpirationParams{
+				SectorNumber:  nums[int(op.Sectors[0])%len(nums)],
+				NewExpiration: epoch + abi.ChainEpoch(op.Expiration),
+			})
+		case minerOpCron:
+			// deliver the events that are due, in the order power would
+			rt.Reset()
+			res = mockrt.Result{}
+			var due []minerCronEvent
+			var later []minerCronEvent
+			for _, ev := range peers.cron {
+				if ev.epoch <= epoch {
+					due = append(due, ev)
+				} else {
+					later = append(later, ev)
+				}
+			}
+			peers.cron = later
+			for _, ev := range due {
+				var payload miner.CronEventPayload
+				if err := payload.UnmarshalCBOR(bytes.NewReader(ev.payload)); err != nil {
+					panic(fmt.Sprintf("miner enrolled a cron event with a bad payload: %v", err))
+				}
+				rt.SetCaller(builtin.StoragePowerActorAddr, builtin.StoragePowerActorCodeID)
+				rt.ExpectValidateCallerAddr(builtin.StoragePowerActorAddr)
+				res = peers.invoke(rt, actor.OnDeferredCronEvent, &payload)
+				if res.MockFailure {
+					return 0
+				}
+			}
+		}
+		if res.MockFailure {
+			return 0
+		}
+
+		rt.GetState(&st)
+		checkMinerState(rt, &st, peers.claim().RawBytePower)
+	}
+	return 1
+}
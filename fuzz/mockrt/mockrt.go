@@ -0,0 +1,194 @@
+// Helpers to run spec-actors methods in the specs-actors mock runtime from a fuzzer
+// The mock runtime is written for `go test`, it reports broken expectations through
+// testing.TB and aborts by panicking, both are turned into results here so that only
+// Go runtime errors and broken invariants crash the harness
+// A package of its own so both the go-fuzz and libfuzzer harnesses can use it
+
+package mockrt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	"github.com/filecoin-project/specs-actors/support/mock"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Panic value raised when the mock runtime reports a broken expectation,
+// e.g. an unexpected send. The harness didn't model what the actor did, which
+// isn't a bug in the actor, so the input is discarded
+type failure string
+
+// Outcome of a single actor method call
+type Result struct {
+	Ret     interface{}
+	Code    exitcode.ExitCode
+	Aborted bool
+	// The mock runtime's expectations didn't match what the actor did
+	MockFailure bool
+}
+
+// Exit code of the abort that abortType and abortCodeField are learned from
+const probeCode = exitcode.ExitCode(4242)
+
+// The mock runtime aborts by panicking with a value of an unexported type. The type,
+// and which of its fields is the exit code, are learned from an abort of our own, so
+// a change to the mock runtime is reported as a harness bug instead of as crashes
+var abortType, abortCodeField = probeAbort()
+
+func probeAbort() (reflect.Type, int) {
+	rt := newMock(IDAddress(0), 0, abi.NewTokenAmount(0))
+	var r interface{}
+	func() {
+		defer func() { r = recover() }()
+		// Abortf is only allowed during a call
+		rt.Call(func(rt vmr.Runtime, _ *adt.EmptyValue) *adt.EmptyValue {
+			rt.Abortf(probeCode, "probe")
+			return nil
+		}, (*adt.EmptyValue)(nil))
+	}()
+	if v := reflect.ValueOf(r); v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == reflect.TypeOf(probeCode) && f.Int() == int64(probeCode) {
+				return v.Type(), i
+			}
+		}
+	}
+	panic(fmt.Sprintf("Bug in harness, can't find the exit code in mock runtime abort %#v", r))
+}
+
+// abortCode extracts the exit code from a panic value raised by the mock runtime's Abortf
+func abortCode(r interface{}) (exitcode.ExitCode, bool) {
+	if reflect.TypeOf(r) != abortType {
+		return 0, false
+	}
+	return exitcode.ExitCode(reflect.ValueOf(r).Field(abortCodeField).Int()), true
+}
+
+// call goes through the mock runtime's Call, so its in-call checks hold, with a
+// trampoline of the same type handing self to method as its runtime
+func call(rt *mock.Runtime, self vmr.Runtime, method interface{}, params interface{}) (res Result) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(failure); ok {
+			res.MockFailure = true
+			return
+		}
+		if code, ok := abortCode(r); ok {
+			res.Aborted = true
+			res.Code = code
+			return
+		}
+		panic(r)
+	}()
+	m := reflect.ValueOf(method)
+	tramp := reflect.MakeFunc(m.Type(), func(args []reflect.Value) []reflect.Value {
+		return m.Call([]reflect.Value{reflect.ValueOf(self), args[1]})
+	})
+	res.Ret = rt.Call(tramp.Interface(), params)
+	res.Code = exitcode.Ok
+	return res
+}
+
+// newMock builds a mock runtime for the actor at receiver
+func newMock(receiver goaddr.Address, epoch abi.ChainEpoch, balance abi.TokenAmount) *mock.Runtime {
+	return mock.NewBuilder(context.Background(), receiver).
+		WithEpoch(epoch).
+		WithBalance(balance, abi.NewTokenAmount(0)).
+		Build(failer{})
+}
+
+// StateBytes returns the encoding of the actor state, st is overwritten
+func StateBytes(r *Runtime, st cbg.CBORUnmarshaler) []byte {
+	r.GetState(st)
+	buf := new(bytes.Buffer)
+	if err := st.(cbg.CBORMarshaler).MarshalCBOR(buf); err != nil {
+		panic(fmt.Sprintf("Couldn't marshal actor state: %v", err))
+	}
+	return buf.Bytes()
+}
+
+// Invoke calls method with r as its runtime, turning aborts and broken mock expectations
+// into results. Any other panic, e.g. a nil dereference or index out of range inside the
+// actor, is a bug and propagates to the fuzzer
+func Invoke(r *Runtime, method interface{}, params interface{}) Result {
+	r.CallerValidated = false
+	return call(r.Runtime, r, method, params)
+}
+
+// InvokeChecked invokes method and checks the state is untouched unless the call succeeded
+// newState returns a fresh pointer to the actor's state type. The balance is rolled back
+// on an abort as the VM would, the state isn't
+func InvokeChecked(r *Runtime, newState func() cbg.CBORUnmarshaler, method interface{}, params interface{}) Result {
+	balance := r.Balance
+	before := StateBytes(r, newState())
+	res := Invoke(r, method, params)
+	if res.MockFailure {
+		return res
+	}
+	if res.Aborted && res.Code == exitcode.Ok {
+		panic("actor aborted with exit code 0")
+	}
+	// The mock runtime doesn't roll back like the VM does, so an abort after a
+	// committed transaction shows up here
+	if res.Aborted {
+		if after := StateBytes(r, newState()); !bytes.Equal(before, after) {
+			panic(fmt.Sprintf("actor state changed by a call that aborted with %d", res.Code))
+		}
+		r.SetBalance(balance)
+	}
+	return res
+}
+
+// InvokeReverting invokes method and rolls the state and balance back if it aborts, as
+// the VM would. Used by the scenario harnesses, where an abort after a send that failed
+// is legitimate. Expectations are cleared afterwards so leftovers don't leak into the
+// next call
+func InvokeReverting(r *Runtime, newState func() cbg.CBORUnmarshaler, method interface{}, params interface{}) Result {
+	balance := r.Balance
+	prev := newState()
+	r.GetState(prev)
+	res := Invoke(r, method, params)
+	if res.Aborted {
+		if res.Code == exitcode.Ok {
+			panic("actor aborted with exit code 0")
+		}
+		r.ReplaceState(prev.(cbg.CBORMarshaler))
+		r.SetBalance(balance)
+	}
+	r.Reset()
+	return res
+}
+
+// ExpectationsMet reports whether everything the harness set up on r was used by the last call
+func ExpectationsMet(r *Runtime) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isMock := r.(failure); !isMock {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	r.Verify()
+	return true
+}
+
+// IDAddress wraps goaddr.NewIDAddress for ids known to be valid
+func IDAddress(id uint64) goaddr.Address {
+	a, err := goaddr.NewIDAddress(id)
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+	}
+	return a
+}
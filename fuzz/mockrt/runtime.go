@@ -0,0 +1,172 @@
+// The runtime every harness runs actors on. Sends are either set up front with the
+// mock runtime's expectations, or, for scenarios spanning several actors where the
+// exact messages can't be known, e.g. the miner's calls into power and reward,
+// answered by OnSend
+
+package mockrt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/crypto"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/support/mock"
+	cid "github.com/ipfs/go-cid"
+	"github.com/minio/blake2b-simd"
+)
+
+// Runtime is the mock runtime with the actors' logs dropped, and randomness and proof
+// verification stubbed. Everything else, state, caller validation and signatures, is
+// left to the mock runtime unless ValidateCallers is set
+type Runtime struct {
+	*mock.Runtime
+	// The actor's balance, sends are paid from it. Set it through SetBalance
+	Balance abi.TokenAmount
+	// Answers a send with the callee's return value, nil for none, and exit code
+	// Sends go to the mock runtime's expectations when nil
+	OnSend func(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode)
+	// Fake proof verifier, a proof is valid when it returns nil
+	VerifyPoSt func(info abi.WindowPoStVerifyInfo) error
+	// Check the caller against what the actor asks for, as the VM does, rather than
+	// against expectations set up front. CallerValidated records that it asked
+	ValidateCallers bool
+	CallerValidated bool
+}
+
+// NewRuntime builds a Runtime for the actor at receiver
+func NewRuntime(receiver goaddr.Address, epoch abi.ChainEpoch, balance abi.TokenAmount) *Runtime {
+	return &Runtime{
+		Runtime: newMock(receiver, epoch, balance),
+		Balance: balance,
+	}
+}
+
+// sendReturn hands what OnSend returned to the caller through its encoding, as the VM does
+type sendReturn struct {
+	v vmr.CBORMarshaler
+}
+
+func (r sendReturn) Into(o vmr.CBORUnmarshaler) error {
+	if r.v == nil {
+		return fmt.Errorf("callee returned nothing")
+	}
+	buf := new(bytes.Buffer)
+	if err := r.v.MarshalCBOR(buf); err != nil {
+		return err
+	}
+	return o.UnmarshalCBOR(buf)
+}
+
+// Log keeps the actors' logs from reaching the mock runtime, which hands them to
+// testing.TB's Logf, so that Logf is only reached when the mock runtime fails
+func (r *Runtime) Log(level vmr.LogLevel, msg string, args ...interface{}) {}
+
+func (r *Runtime) CurrentBalance() abi.TokenAmount {
+	return r.Balance
+}
+
+// SetBalance sets the balance here and in the mock runtime
+func (r *Runtime) SetBalance(balance abi.TokenAmount) {
+	r.Balance = balance
+	r.Runtime.SetBalance(balance)
+}
+
+func (r *Runtime) Send(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.SendReturn, exitcode.ExitCode) {
+	if r.OnSend == nil {
+		// checked and paid for by the mock runtime
+		r.Runtime.SetBalance(r.Balance)
+		ret, code := r.Runtime.Send(to, method, params, value)
+		r.Balance = r.Runtime.CurrentBalance()
+		return ret, code
+	}
+	if value.LessThan(big.Zero()) || value.GreaterThan(r.Balance) {
+		// the VM fails the send rather than aborting the caller
+		return sendReturn{}, exitcode.SysErrInsufficientFunds
+	}
+	ret, code := r.OnSend(to, method, params, value)
+	if code != exitcode.Ok {
+		// the callee's changes, including the transfer, are reverted
+		return sendReturn{}, code
+	}
+	r.Balance = big.Sub(r.Balance, value)
+	return sendReturn{ret}, code
+}
+
+// GetRandomness derives the randomness from its inputs, so replays are deterministic
+func (r *Runtime) GetRandomness(tag crypto.DomainSeparationTag, epoch abi.ChainEpoch, entropy []byte) abi.Randomness {
+	buf := make([]byte, 16, 16+len(entropy))
+	binary.BigEndian.PutUint64(buf, uint64(tag))
+	binary.BigEndian.PutUint64(buf[8:], uint64(epoch))
+	h := blake2b.Sum256(append(buf, entropy...))
+	return h[:]
+}
+
+// validating aborts if the method already validated its caller, as the VM does
+func (r *Runtime) validating() {
+	if r.CallerValidated {
+		r.Abortf(exitcode.SysErrorIllegalActor, "method must validate caller identity exactly once")
+	}
+	r.CallerValidated = true
+}
+
+func (r *Runtime) ValidateImmediateCallerAcceptAny() {
+	if !r.ValidateCallers {
+		r.Runtime.ValidateImmediateCallerAcceptAny()
+		return
+	}
+	r.validating()
+}
+
+func (r *Runtime) ValidateImmediateCallerIs(addrs ...goaddr.Address) {
+	if !r.ValidateCallers {
+		r.Runtime.ValidateImmediateCallerIs(addrs...)
+		return
+	}
+	r.validating()
+	for _, a := range addrs {
+		if a == r.Caller() {
+			return
+		}
+	}
+	r.Abortf(exitcode.SysErrForbidden, "caller %s is not one of %v", r.Caller(), addrs)
+}
+
+func (r *Runtime) ValidateImmediateCallerType(types ...cid.Cid) {
+	if !r.ValidateCallers {
+		r.Runtime.ValidateImmediateCallerType(types...)
+		return
+	}
+	r.validating()
+	code, ok := r.GetActorCodeCID(r.Caller())
+	if !ok {
+		panic(failure(fmt.Sprintf("caller %s has no code set", r.Caller())))
+	}
+	for _, t := range types {
+		if t.Equals(code) {
+			return
+		}
+	}
+	r.Abortf(exitcode.SysErrForbidden, "caller type %s is not one of %v", code, types)
+}
+
+type syscalls struct {
+	vmr.Syscalls
+	r *Runtime
+}
+
+func (s syscalls) VerifyPoSt(info abi.WindowPoStVerifyInfo) error {
+	if s.r.VerifyPoSt == nil {
+		panic(failure("unexpected PoSt verification"))
+	}
+	return s.r.VerifyPoSt(info)
+}
+
+func (r *Runtime) Syscalls() vmr.Syscalls {
+	return syscalls{r.Runtime.Syscalls(), r}
+}
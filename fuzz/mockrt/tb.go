@@ -0,0 +1,43 @@
+// The mock runtime's builder only accepts a testing.TB, this is the one place
+// the testing package is used
+
+package mockrt
+
+import (
+	"fmt"
+	"testing"
+)
+
+// failer is the testing.TB handed to the mock runtime, everything reported to it is
+// a failure. The embedded nil interface only satisfies testing.TB's private method,
+// every method the mock runtime calls is implemented below
+type failer struct {
+	testing.TB
+}
+
+func (failer) Helper()      {}
+func (failer) Name() string { return "fuzz" }
+func (failer) Failed() bool { return false }
+
+// The mock runtime logs a broken expectation and then exits the process, which a
+// fuzzer would report as a crash. The actors' logs are kept from it, see Runtime.Log
+func (failer) Log(args ...interface{}) {
+	panic(failure(fmt.Sprint(args...)))
+}
+func (failer) Logf(format string, args ...interface{}) {
+	panic(failure(fmt.Sprintf(format, args...)))
+}
+func (failer) FailNow() { panic(failure("FailNow")) }
+func (failer) Fail()    { panic(failure("Fail")) }
+func (failer) Error(args ...interface{}) {
+	panic(failure(fmt.Sprint(args...)))
+}
+func (failer) Errorf(format string, args ...interface{}) {
+	panic(failure(fmt.Sprintf(format, args...)))
+}
+func (failer) Fatal(args ...interface{}) {
+	panic(failure(fmt.Sprint(args...)))
+}
+func (failer) Fatalf(format string, args ...interface{}) {
+	panic(failure(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,283 @@
+// Stateful fuzzing of the multisig actor in the specs-actors mock runtime
+// A fuzzed sequence of proposals, approvals, cancellations and signer changes
+// from fuzzed callers, with the invariants checked after every step
+
+package fuzz
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/multisig"
+	"github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Upper bound on the steps in a scenario
+const maxScenarioSteps = 64
+
+// Accounts that may be signers, callers and recipients
+var msigParties = []goaddr.Address{
+	mockrt.IDAddress(100),
+	mockrt.IDAddress(101),
+	mockrt.IDAddress(102),
+	mockrt.IDAddress(103),
+	mockrt.IDAddress(104),
+}
+
+const (
+	msigOpPropose = iota
+	msigOpApprove
+	msigOpCancel
+	msigOpAddSigner
+	msigOpRemoveSigner
+	msigOpSwapSigner
+	msigOpChangeThreshold
+	numMsigOps
+)
+
+// One step of a multisig scenario, the fields used depend on Kind
+type msigOp struct {
+	Kind uint8
+	// Index into msigParties, one past the end means the multisig calls itself
+	Caller uint8
+	Addr   uint8
+	Addr2  uint8
+	Txn    uint8
+	Flag   bool
+	Value  uint16
+	Method uint8
+	Params []byte
+	// Exit code of the callee when a transaction is executed
+	SendCode uint8
+	Advance  uint8
+}
+
+func newMultisigState() cbg.CBORUnmarshaler {
+	return new(multisig.State)
+}
+
+// pendingTxn looks up a pending transaction
+func pendingTxn(rt *mockrt.Runtime, st *multisig.State, id multisig.TxnID) (*multisig.Transaction, bool) {
+	txns, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load pending transactions: %v", err))
+	}
+	var txn multisig.Transaction
+	found, err := txns.Get(id, &txn)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read pending transaction %d: %v", id, err))
+	}
+	return &txn, found
+}
+
+// checkMultisigState checks the invariants that hold between calls
+func checkMultisigState(rt *mockrt.Runtime, st *multisig.State) {
+	if st.NumApprovalsThreshold > int64(len(st.Signers)) {
+		panic(fmt.Sprintf("threshold %d above the %d signers", st.NumApprovalsThreshold, len(st.Signers)))
+	}
+	seen := make(map[goaddr.Address]bool)
+	for _, s := range st.Signers {
+		if seen[s] {
+			panic(fmt.Sprintf("signer %s listed twice", s))
+		}
+		seen[s] = true
+	}
+
+	txns, err := adt.AsMap(adt.AsStore(rt), st.PendingTxns)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load pending transactions: %v", err))
+	}
+	var txn multisig.Transaction
+	err = txns.ForEach(&txn, func(k string) error {
+		// keys are varint encoded transaction ids
+		id, n := binary.Varint([]byte(k))
+		if n <= 0 {
+			return fmt.Errorf("bad transaction key %x", k)
+		}
+		if multisig.TxnID(id) >= st.NextTxnID {
+			return fmt.Errorf("pending transaction %d not below the next id %d", id, st.NextTxnID)
+		}
+		if len(txn.Approved) == 0 {
+			return fmt.Errorf("pending transaction %d without approvals", id)
+		}
+		approved := make(map[goaddr.Address]bool)
+		for _, a := range txn.Approved {
+			if approved[a] {
+				return fmt.Errorf("pending transaction %d approved twice by %s", id, a)
+			}
+			approved[a] = true
+		}
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Bad pending transactions: %v", err))
+	}
+}
+
+// checkVesting checks the locked amount at elapsed against the previous one
+func checkVesting(st *multisig.State, elapsed abi.ChainEpoch, prev abi.TokenAmount) abi.TokenAmount {
+	locked := st.AmountLocked(elapsed)
+	if locked.LessThan(big.Zero()) || locked.GreaterThan(st.InitialBalance) {
+		panic(fmt.Sprintf("locked amount %s outside [0, %s]", locked, st.InitialBalance))
+	}
+	if elapsed >= st.UnlockDuration && !locked.IsZero() {
+		panic(fmt.Sprintf("%s still locked %d epochs in, unlock duration %d", locked, elapsed, st.UnlockDuration))
+	}
+	if locked.GreaterThan(prev) {
+		panic(fmt.Sprintf("locked amount went up from %s to %s", prev, locked))
+	}
+	return locked
+}
+
+// Fuzzing a sequence of multisig calls from fuzzed callers
+// Checks threshold and signer invariants, that a transaction executes at most once and
+// only with enough approvals, and that locked funds are never spent
+func FuzzMultisigScenario(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var nSigners, threshold uint8
+	var unlock uint16
+	var initial uint32
+	var ops []msigOp
+	f.Fuzz(&nSigners)
+	f.Fuzz(&threshold)
+	f.Fuzz(&unlock)
+	f.Fuzz(&initial)
+	f.Fuzz(&ops)
+	if len(ops) > maxScenarioSteps {
+		ops = ops[:maxScenarioSteps]
+	}
+
+	balance := abi.NewTokenAmount(int64(initial))
+	rt := mockrt.NewRuntime(dispatchMultisigAddr, 0, balance)
+	for _, p := range msigParties {
+		rt.SetAddressActorType(p, builtin.AccountActorCodeID)
+	}
+	params := &multisig.ConstructorParams{
+		Signers:               msigParties[:int(nSigners)%len(msigParties)+1],
+		NumApprovalsThreshold: int64(threshold) % int64(len(msigParties)+1),
+		UnlockDuration:        abi.ChainEpoch(unlock),
+	}
+	// the initial balance arrives with the constructor call
+	rt.SetReceived(balance)
+	if !construct(rt, multisig.Actor{}.Exports(), initCaller, expectAddr(builtin.InitActorAddr), params) {
+		return 0
+	}
+	rt.SetReceived(big.Zero())
+
+	var st multisig.State
+	rt.GetState(&st)
+	checkMultisigState(rt, &st)
+	epoch := abi.ChainEpoch(0)
+	locked := checkVesting(&st, epoch-st.StartEpoch, st.InitialBalance)
+	// executed or cancelled, the id must never come back
+	gone := make(map[multisig.TxnID]bool)
+
+	actor := multisig.Actor{}
+	for _, op := range ops {
+		epoch += abi.ChainEpoch(op.Advance)
+		rt.SetEpoch(epoch)
+		if c := int(op.Caller) % (len(msigParties) + 1); c < len(msigParties) {
+			rt.SetCaller(msigParties[c], builtin.AccountActorCodeID)
+		} else {
+			rt.SetCaller(dispatchMultisigAddr, builtin.MultisigActorCodeID)
+		}
+		addr := msigParties[int(op.Addr)%len(msigParties)]
+		addr2 := msigParties[int(op.Addr2)%len(msigParties)]
+
+		var method, p interface{}
+		var txnID multisig.TxnID
+		var txn *multisig.Transaction
+		approvals := 0
+		switch int(op.Kind) % numMsigOps {
+		case msigOpPropose:
+			txnID = st.NextTxnID
+			txn = &multisig.Transaction{To: addr, Value: abi.NewTokenAmount(int64(op.Value)), Method: abi.MethodNum(op.Method), Params: op.Params}
+			method, p = actor.Propose, &multisig.ProposeParams{To: txn.To, Value: txn.Value, Method: txn.Method, Params: txn.Params}
+			rt.ExpectValidateCallerType(builtin.CallerTypesSignable...)
+		case msigOpApprove, msigOpCancel:
+			txnID = multisig.TxnID(int64(op.Txn) % (int64(st.NextTxnID) + 1))
+			if pending, found := pendingTxn(rt, &st, txnID); found {
+				txn = pending
+				approvals = len(pending.Approved)
+			}
+			method = actor.Approve
+			if int(op.Kind)%numMsigOps == msigOpCancel {
+				method = actor.Cancel
+				txn = nil
+			}
+			p = &multisig.TxnIDParams{ID: txnID}
+			rt.ExpectValidateCallerType(builtin.CallerTypesSignable...)
+		case msigOpAddSigner:
+			method, p = actor.AddSigner, &multisig.AddSignerParams{Signer: addr, Increase: op.Flag}
+			rt.ExpectValidateCallerAddr(dispatchMultisigAddr)
+		case msigOpRemoveSigner:
+			method, p = actor.RemoveSigner, &multisig.RemoveSignerParams{Signer: addr, Decrease: op.Flag}
+			rt.ExpectValidateCallerAddr(dispatchMultisigAddr)
+		case msigOpSwapSigner:
+			method, p = actor.SwapSigner, &multisig.SwapSignerParams{From: addr, To: addr2}
+			rt.ExpectValidateCallerAddr(dispatchMultisigAddr)
+		case msigOpChangeThreshold:
+			method, p = actor.ChangeNumApprovalsThreshold, &multisig.ChangeNumApprovalsThresholdParams{NewThreshold: uint64(op.Txn) % uint64(len(msigParties)+2)}
+			rt.ExpectValidateCallerAddr(dispatchMultisigAddr)
+		}
+		sendCode := exitcode.ExitCode(0)
+		if op.SendCode%4 == 0 {
+			sendCode = exitcode.ExitCode(op.SendCode)
+		}
+		if txn != nil {
+			// the transaction may reach its threshold with this call
+			rt.ExpectSend(txn.To, txn.Method, runtime.CBORBytes(txn.Params), txn.Value, nil, sendCode)
+		}
+		prevThreshold := st.NumApprovalsThreshold
+
+		res := mockrt.InvokeReverting(rt, newMultisigState, method, p)
+		if res.MockFailure {
+			return 0
+		}
+		rt.GetState(&st)
+		checkMultisigState(rt, &st)
+		locked = checkVesting(&st, epoch-st.StartEpoch, locked)
+		if res.Aborted {
+			continue
+		}
+
+		switch int(op.Kind) % numMsigOps {
+		case msigOpPropose, msigOpApprove, msigOpCancel:
+			if gone[txnID] {
+				panic(fmt.Sprintf("call on transaction %d succeeded after it was executed or cancelled", txnID))
+			}
+		}
+		if txn == nil {
+			if int(op.Kind)%numMsigOps == msigOpCancel {
+				gone[txnID] = true
+			}
+			continue
+		}
+		if _, stillPending := pendingTxn(rt, &st, txnID); stillPending {
+			continue
+		}
+		// executed by this call
+		gone[txnID] = true
+		if int64(approvals+1) < prevThreshold {
+			panic(fmt.Sprintf("transaction %d executed with %d approvals, threshold %d", txnID, approvals+1, prevThreshold))
+		}
+		if sendCode != exitcode.Ok {
+			continue
+		}
+		if big.Sub(balance, txn.Value).LessThan(locked) {
+			panic(fmt.Sprintf("transaction %d spent %s of %s with %s locked", txnID, txn.Value, balance, locked))
+		}
+		balance = big.Sub(balance, txn.Value)
+		rt.SetBalance(balance)
+	}
+	return 1
+}
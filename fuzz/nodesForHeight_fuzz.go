@@ -11,6 +11,7 @@ import (
 	"math/big"
 	"math/rand"
 
+	amtipld "github.com/filecoin-project/go-amt-ipld"
 	"github.com/google/gofuzz/bytesource"
 )
 
@@ -61,23 +62,111 @@ func bigNodesForHeight(width, height *big.Int) uint64 {
 	return bigVal.Uint64()
 }
 
-// TODO also check when modifying width, even though this is a const?
-// currently search space is small enought that you might as well just test all possibilities
+// implementation using integer shifts, only valid for power of two widths
+// width == 1 << widthShift
+func shiftNodesForHeight(widthShift, height uint) uint64 {
+	bits := widthShift * height
+	if bits >= 64 {
+		return math.MaxUint64
+	}
+	return 1 << bits
+}
+
+// The AMT needs a power of two width for its bitmap, so these are all the widths
+// it could be configured with. Heights go past 64 to cover saturation
+const (
+	maxWidthShift  = 16
+	maxSweepHeight = 64
+)
+
+// checkNodesForHeight compares the three implementations for a single input
+func checkNodesForHeight(widthShift, height uint) error {
+	w := 1 << widthShift
+	result1 := nodesForHeight(w, int(height))
+	result2 := bigNodesForHeight(big.NewInt(int64(w)), big.NewInt(int64(height)))
+	result3 := shiftNodesForHeight(widthShift, height)
+
+	if result1 != result2 || result2 != result3 {
+		return fmt.Errorf("width=%d (widthShift=%d), height=%d: float %d, big %d, shift %d not equal",
+			w, widthShift, height, result1, result2, result3)
+	}
+	return nil
+}
+
+// from go-amt-ipld/amt.go 6263827e49, the child a lookup of index descends into
+// at a node of the given height, and the index within that child
+func indexToChild(index uint64, width, height int) (uint64, uint64) {
+	nfh := nodesForHeight(width, height)
+	return index / nfh, index % nfh
+}
+
+// checkIndexPath walks index down from height to a leaf the way the AMT does,
+// and checks every step stays within the node and the path adds back up to index
+func checkIndexPath(index uint64, height int) error {
+	bigIndex := new(big.Int).SetUint64(index)
+	sum := big.NewInt(0)
+	i := index
+	for h := height; h >= 0; h-- {
+		sub, rest := indexToChild(i, width, h)
+		if sub >= width {
+			return fmt.Errorf("index %d at height %d: child %d out of range at height %d", index, height, sub, h)
+		}
+		// sum += sub * width^h, in arbitrary precision
+		step := new(big.Int).Exp(bigWidth, big.NewInt(int64(h)), nil)
+		step.Mul(step, new(big.Int).SetUint64(sub))
+		sum.Add(sum, step)
+		i = rest
+	}
+	if sum.Cmp(bigIndex) != 0 {
+		return fmt.Errorf("index %d at height %d: path adds up to %s", index, height, sum)
+	}
+	return nil
+}
+
+// checkNodesForHeightExhaustive checks every width/height combination and the index paths around MaxIndex
+// The search space is small enough to just test all possibilities
+func checkNodesForHeightExhaustive() error {
+	for widthShift := uint(0); widthShift <= maxWidthShift; widthShift++ {
+		for height := uint(0); height <= maxSweepHeight; height++ {
+			if err := checkNodesForHeight(widthShift, height); err != nil {
+				return err
+			}
+		}
+	}
+	for _, index := range []uint64{0, 1, width - 1, width, amtipld.MaxIndex - 1} {
+		if err := checkIndexPath(index, maxHeight); err != nil {
+			return err
+		}
+	}
+	// MaxIndex itself is out of range, it must not wrap around into a valid child
+	if sub, _ := indexToChild(amtipld.MaxIndex, width, maxHeight); sub < width {
+		return fmt.Errorf("MaxIndex maps to child %d at maxHeight, it would alias a valid index", sub)
+	}
+	if nodesForHeight(width, maxHeight+1) < amtipld.MaxIndex {
+		return fmt.Errorf("maxHeight can't hold MaxIndex")
+	}
+	return nil
+}
+
+// Fuzzes the width as well as the height, and the index path at maxHeight
 func FuzzNodesForHeight(data []byte) int {
-	// because we only want a single int within our range, we just use rand
+	// because we only want a few ints within our range, we just use rand
 	// rather than the full gofuzz `Fuzzer`
 	// could also just use mod, but I like this more :)
 	r := rand.New(bytesource.New(data))
-	height := r.Intn(maxHeight + 2) // should only be +1 but check for breathing room
-	bigHeight := big.NewInt(int64(height))
-	result1 := nodesForHeight(width, height)
-	result2 := bigNodesForHeight(bigWidth, bigHeight)
-
-	if result1 != result2 {
-		fmt.Printf("Input: width=%d, height=%d", width, height)
-		fmt.Printf("Result1=%d", result1)
-		fmt.Printf("Result2=%d", result2)
-		panic("Not Equal!")
+	widthShift := uint(r.Intn(maxWidthShift + 1))
+	height := uint(r.Intn(maxSweepHeight + 1))
+	if err := checkNodesForHeight(widthShift, height); err != nil {
+		panic(err.Error())
+	}
+
+	// indexes near MaxIndex are the interesting ones
+	index := amtipld.MaxIndex - 1 - uint64(r.Intn(1<<16))
+	if r.Intn(2) == 0 {
+		index = uint64(r.Int63n(amtipld.MaxIndex))
+	}
+	if err := checkIndexPath(index, maxHeight); err != nil {
+		panic(err.Error())
 	}
 	return 0
 }
@@ -0,0 +1,9 @@
+package fuzz
+
+import "testing"
+
+func TestNodesForHeightExhaustive(t *testing.T) {
+	if err := checkNodesForHeightExhaustive(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,464 @@
+// Stateful fuzzing of the power actor's accounting of miner power
+// Miners are created through power.CreateMiner and run as miner actors on runtimes of
+// their own, their calls to power are handed to it. Faults, recoveries, PoSts,
+// terminations and extensions on the miners drive the power callbacks, cron ticks on
+// power drive the miners' deferred events. The mock runtime can't take an actor calling
+// back into power while power is calling it, so a miner is constructed once CreateMiner
+// returns and the cron events power sent are delivered once OnEpochTickEnd returns
+
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	init_ "github.com/filecoin-project/specs-actors/actors/builtin/init"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/power"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Upper bound on the miners created in one scenario
+const maxPowerMiners = 8
+
+// First ID the fake init actor hands out
+const firstPowerMinerID = 1000
+
+var powerMinerCreators = []goaddr.Address{mockrt.IDAddress(100), mockrt.IDAddress(101)}
+
+// A miner-coded address power never created
+var powerStranger = actorRef{mockrt.IDAddress(firstPowerMinerID + maxPowerMiners), builtin.StorageMinerActorCodeID}
+
+const (
+	powerOpCreateMiner = iota
+	powerOpDeclareFaults
+	powerOpDeclareRecovered
+	powerOpPoSt
+	powerOpTerminate
+	powerOpExtend
+	powerOpStranger
+	powerOpTick
+	numPowerOps
+)
+
+// One step of a power scenario, the fields used depend on Kind
+type powerOp struct {
+	Kind  uint8
+	Miner uint8
+	// Sectors put in a new miner
+	NumSectors uint8
+	// Indexes into the miner's sectors
+	Sectors    []uint8
+	Skipped    []uint8
+	Expiration uint16
+	Advance    uint16
+}
+
+func newPowerState() cbg.CBORUnmarshaler {
+	return new(power.State)
+}
+
+// A miner actor created through power
+type powerMiner struct {
+	id      goaddr.Address
+	owner   goaddr.Address
+	worker  goaddr.Address
+	rt      *mockrt.Runtime
+	sectors []abi.SectorNumber
+}
+
+// A cron event enrolled with power, identified by its payload
+type powerCronEvent struct {
+	miner     goaddr.Address
+	epoch     abi.ChainEpoch
+	payload   []byte
+	delivered int
+}
+
+// A miner power asked init to create
+type powerExec struct {
+	id     goaddr.Address
+	params []byte
+	value  abi.TokenAmount
+}
+
+// powerPeers fakes init and reward for power, runs the miners it creates and hands their
+// calls to power
+type powerPeers struct {
+	power     *mockrt.Runtime
+	epoch     abi.ChainEpoch
+	nextID    uint64
+	created   []powerExec
+	miners    []*powerMiner
+	events    []*powerCronEvent
+	pending   []*powerCronEvent
+	workerKey goaddr.Address
+}
+
+func (p *powerPeers) miner(a goaddr.Address) *powerMiner {
+	for _, m := range p.miners {
+		if m.id == a {
+			return m
+		}
+	}
+	return nil
+}
+
+// send answers the sends the power actor makes. Miners are constructed and cron events
+// delivered by the harness once power returns
+func (p *powerPeers) send(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	switch {
+	case to == builtin.InitActorAddr && method == builtin.MethodsInit.Exec:
+		exec := params.(*init_.ExecParams)
+		if !exec.CodeCID.Equals(builtin.StorageMinerActorCodeID) {
+			panic(fmt.Sprintf("power asked init to create an actor with code %s", exec.CodeCID))
+		}
+		id := mockrt.IDAddress(p.nextID)
+		robust, err := goaddr.NewActorAddress(id.Bytes())
+		if err != nil {
+			panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+		}
+		p.nextID++
+		p.created = append(p.created, powerExec{id: id, params: exec.ConstructorParams, value: value})
+		return &init_.ExecReturn{IDAddress: id, RobustAddress: robust}, exitcode.Ok
+	case to == builtin.RewardActorAddr && method == builtin.MethodsReward.LastPerEpochReward:
+		r := abi.NewTokenAmount(1e9)
+		return &r, exitcode.Ok
+	case to == builtin.RewardActorAddr && method == builtin.MethodsReward.UpdateNetworkKPI:
+		return nil, exitcode.Ok
+	case method == builtin.MethodsMiner.OnDeferredCronEvent:
+		if p.miner(to) == nil {
+			panic(fmt.Sprintf("power delivered a cron event to %s which it never created", to))
+		}
+		buf := new(bytes.Buffer)
+		if err := params.MarshalCBOR(buf); err != nil {
+			panic(fmt.Sprintf("Couldn't encode cron payload: %v", err))
+		}
+		for _, ev := range p.events {
+			if ev.miner == to && ev.delivered == 0 && bytes.Equal(ev.payload, buf.Bytes()) {
+				ev.delivered++
+				p.pending = append(p.pending, ev)
+				return nil, exitcode.Ok
+			}
+		}
+		panic(fmt.Sprintf("power delivered a cron event to %s that was never enrolled or is already delivered", to))
+	}
+	panic(fmt.Sprintf("power sent method %d to %s, which the fakes don't model", method, to))
+}
+
+// minerSend answers the sends miner m makes, its calls to power are handed to power
+func (p *powerPeers) minerSend(m *powerMiner) func(goaddr.Address, abi.MethodNum, vmr.CBORMarshaler, abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	return func(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+		switch {
+		case to == m.worker && method == builtin.MethodsAccount.PubkeyAddress:
+			return &p.workerKey, exitcode.Ok
+		case to == builtin.RewardActorAddr && method == builtin.MethodsReward.LastPerEpochReward:
+			r := abi.NewTokenAmount(1e9)
+			return &r, exitcode.Ok
+		case to == builtin.StoragePowerActorAddr:
+			ret, code := forward(p.power, power.Actor{}.Exports(), newPowerState, actorRef{m.id, builtin.StorageMinerActorCodeID}, method, params, value)
+			if code == exitcode.Ok && method == builtin.MethodsPower.EnrollCronEvent {
+				ev := params.(*power.EnrollCronEventParams)
+				p.events = append(p.events, &powerCronEvent{miner: m.id, epoch: ev.EventEpoch, payload: ev.Payload})
+			}
+			return ret, code
+		case to == builtin.StorageMarketActorAddr && method == builtin.MethodsMarket.OnMinerSectorsTerminate:
+			return nil, exitcode.Ok
+		case to == builtin.StorageMarketActorAddr && method == builtin.MethodsMarket.VerifyDealsOnSectorProveCommit:
+			return &market.VerifyDealsOnSectorProveCommitReturn{DealWeight: big.Zero(), VerifiedDealWeight: big.Zero()}, exitcode.Ok
+		case to == builtin.BurntFundsActorAddr || to == m.owner:
+			return nil, exitcode.Ok
+		}
+		panic(fmt.Sprintf("miner %s sent method %d to %s, which the fakes don't model", m.id, method, to))
+	}
+}
+
+// invoke calls miner m from caller, rolling back the power actor and the enrolled cron
+// events with the miner's state if it aborts, as the VM would
+func (p *powerPeers) invoke(m *powerMiner, caller actorRef, method interface{}, params interface{}) mockrt.Result {
+	events := len(p.events)
+	var powerSt power.State
+	p.power.GetState(&powerSt)
+	powerBalance := p.power.Balance
+	m.rt.SetCaller(caller.addr, caller.code)
+	res := mockrt.InvokeReverting(m.rt, newMinerState, method, params)
+	if res.Aborted {
+		p.events = p.events[:events]
+		p.power.ReplaceState(&powerSt)
+		p.power.SetBalance(powerBalance)
+	}
+	return res
+}
+
+// construct runs the constructor of a miner power created, as init would have, and puts
+// n committed sectors in it
+func (p *powerPeers) construct(exec powerExec, n int, expiration abi.ChainEpoch) bool {
+	var params power.MinerConstructorParams
+	if err := params.UnmarshalCBOR(bytes.NewReader(exec.params)); err != nil {
+		panic(fmt.Sprintf("power created a miner with bad constructor params: %v", err))
+	}
+	m := &powerMiner{id: exec.id, owner: params.OwnerAddr, worker: params.WorkerAddr}
+	m.rt = mockrt.NewRuntime(exec.id, p.epoch, exec.value)
+	m.rt.OnSend = p.minerSend(m)
+	m.rt.VerifyPoSt = fakeVerifyPoSt
+	m.rt.ValidateCallers = true
+	for _, c := range powerMinerCreators {
+		m.rt.SetAddressActorType(c, builtin.AccountActorCodeID)
+	}
+	m.rt.SetAddressActorType(builtin.InitActorAddr, builtin.InitActorCodeID)
+	m.rt.SetAddressActorType(builtin.StoragePowerActorAddr, builtin.StoragePowerActorCodeID)
+	p.power.SetAddressActorType(m.id, builtin.StorageMinerActorCodeID)
+
+	res := p.invoke(m, initCaller, miner.Actor{}.Constructor, &params)
+	if res.MockFailure {
+		return false
+	}
+	if res.Aborted {
+		panic(fmt.Sprintf("miner %s created by power failed to construct: %d", m.id, res.Code))
+	}
+	p.miners = append(p.miners, m)
+	m.sectors = plantSectors(m.rt, n, expiration)
+	return true
+}
+
+// deadline finds the deadline the sector idx points at is due in
+func (m *powerMiner) deadline(idx []uint8) uint64 {
+	if len(idx) == 0 {
+		return 0
+	}
+	var st miner.State
+	m.rt.GetState(&st)
+	first := uint64(m.sectors[int(idx[0])%len(m.sectors)])
+	deadlines, err := st.LoadDeadlines(adt.AsStore(m.rt))
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load deadlines: %v", err))
+	}
+	for d, bf := range deadlines.Due {
+		if bitSetOf(bf)[first] {
+			return uint64(d)
+		}
+	}
+	return 0
+}
+
+// claims reads the power table
+func claims(rt *mockrt.Runtime, root cid.Cid) map[goaddr.Address]power.Claim {
+	m, err := adt.AsMap(adt.AsStore(rt), root)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't load claims: %v", err))
+	}
+	out := make(map[goaddr.Address]power.Claim)
+	var c power.Claim
+	err = m.ForEach(&c, func(k string) error {
+		a, err := goaddr.NewFromBytes([]byte(k))
+		if err != nil {
+			return err
+		}
+		out[a] = c
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't read claims: %v", err))
+	}
+	return out
+}
+
+// checkPowerState checks the totals add up to the claims and each miner's claim matches
+// the sectors in its own state
+func checkPowerState(p *powerPeers, st *power.State) {
+	table := claims(p.power, st.Claims)
+	raw, qa := big.Zero(), big.Zero()
+	for a, c := range table {
+		if c.RawBytePower.LessThan(big.Zero()) || c.QualityAdjPower.LessThan(big.Zero()) {
+			panic(fmt.Sprintf("negative claim for %s: %s raw, %s QA", a, c.RawBytePower, c.QualityAdjPower))
+		}
+		raw = big.Add(raw, c.RawBytePower)
+		qa = big.Add(qa, c.QualityAdjPower)
+	}
+	if !raw.Equals(st.TotalRawBytePower) {
+		panic(fmt.Sprintf("total raw power %s but claims add up to %s", st.TotalRawBytePower, raw))
+	}
+	if !qa.Equals(st.TotalQualityAdjPower) {
+		panic(fmt.Sprintf("total QA power %s but claims add up to %s", st.TotalQualityAdjPower, qa))
+	}
+	if int64(len(table)) != st.MinerCount || len(table) != len(p.miners) {
+		panic(fmt.Sprintf("%d claims, miner count %d, %d miners created", len(table), st.MinerCount, len(p.miners)))
+	}
+	for _, m := range p.miners {
+		c, ok := table[m.id]
+		if !ok {
+			panic(fmt.Sprintf("no claim for miner %s", m.id))
+		}
+		var mst miner.State
+		m.rt.GetState(&mst)
+		checkMinerState(m.rt, &mst, c.RawBytePower)
+	}
+}
+
+// checkCronDelivery checks every event due by epoch was delivered once and no other was
+func checkCronDelivery(events []*powerCronEvent, epoch abi.ChainEpoch) {
+	for _, ev := range events {
+		want := 0
+		if ev.epoch <= epoch {
+			want = 1
+		}
+		if ev.delivered != want {
+			panic(fmt.Sprintf("cron event for %s at epoch %d delivered %d times by epoch %d", ev.miner, ev.epoch, ev.delivered, epoch))
+		}
+	}
+}
+
+// Fuzzing miner creation and the power callbacks from real miners, totals must match the
+// claims and each claim the miner's sectors at every epoch
+func FuzzPowerScenario(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var ops []powerOp
+	f.Fuzz(&ops)
+	if len(ops) > maxScenarioSteps {
+		ops = ops[:maxScenarioSteps]
+	}
+
+	var workerKey [48]byte
+	key, err := goaddr.NewBLSAddress(workerKey[:])
+	if err != nil {
+		panic(fmt.Sprintf("Bug in harness, couldn't create address: %v", err))
+	}
+	rt := mockrt.NewRuntime(builtin.StoragePowerActorAddr, 0, big.Zero())
+	peers := &powerPeers{power: rt, nextID: firstPowerMinerID, workerKey: key}
+	rt.OnSend = peers.send
+	rt.ValidateCallers = true
+	for _, c := range powerMinerCreators {
+		rt.SetAddressActorType(c, builtin.AccountActorCodeID)
+	}
+	rt.SetAddressActorType(powerStranger.addr, powerStranger.code)
+	actor := power.Actor{}
+	if !construct(rt, actor.Exports(), systemCaller, nil, (*adt.EmptyValue)(nil)) {
+		panic("Bug in harness, couldn't construct the power actor")
+	}
+
+	var st power.State
+	for _, op := range ops {
+		peers.epoch += abi.ChainEpoch(op.Advance) % miner.WPoStProvingPeriod
+		rt.SetEpoch(peers.epoch)
+		for _, m := range peers.miners {
+			m.rt.SetEpoch(peers.epoch)
+		}
+
+		switch kind := int(op.Kind) % numPowerOps; kind {
+		case powerOpCreateMiner:
+			if len(peers.miners) == maxPowerMiners {
+				continue
+			}
+			creator := powerMinerCreators[int(op.Miner)%len(powerMinerCreators)]
+			rt.SetCaller(creator, builtin.AccountActorCodeID)
+			peers.created = nil
+			res := mockrt.InvokeReverting(rt, newPowerState, actor.CreateMiner, &power.CreateMinerParams{
+				Owner:         creator,
+				Worker:        creator,
+				SealProofType: minerSealProof,
+				Peer:          []byte("peer"),
+			})
+			if res.MockFailure {
+				return 0
+			}
+			if !res.Aborted {
+				if len(peers.created) != 1 {
+					panic(fmt.Sprintf("CreateMiner succeeded having created %d miners", len(peers.created)))
+				}
+				// init constructs the miner inside Exec on the chain
+				expiration := peers.epoch + abi.ChainEpoch(op.Expiration) + miner.WPoStProvingPeriod
+				if !peers.construct(peers.created[0], int(op.NumSectors)%maxMinerSectors+1, expiration) {
+					return 0
+				}
+			}
+		case powerOpTick:
+			rt.SetCaller(builtin.CronActorAddr, builtin.CronActorCodeID)
+			peers.pending = nil
+			res := mockrt.InvokeReverting(rt, newPowerState, actor.OnEpochTickEnd, (*adt.EmptyValue)(nil))
+			if res.MockFailure {
+				return 0
+			}
+			if res.Aborted {
+				panic(fmt.Sprintf("OnEpochTickEnd aborted with %d", res.Code))
+			}
+			checkCronDelivery(peers.events, peers.epoch)
+			// the events power sent, handed to the miners now it has returned
+			for _, ev := range peers.pending {
+				var payload miner.CronEventPayload
+				if err := payload.UnmarshalCBOR(bytes.NewReader(ev.payload)); err != nil {
+					panic(fmt.Sprintf("miner enrolled a cron event with a bad payload: %v", err))
+				}
+				if res := peers.invoke(peers.miner(ev.miner), powerCaller, miner.Actor{}.OnDeferredCronEvent, &payload); res.MockFailure {
+					return 0
+				}
+			}
+		case powerOpStranger:
+			_, code := forward(rt, actor.Exports(), newPowerState, powerStranger, builtin.MethodsPower.OnSectorProveCommit, &power.OnSectorProveCommitParams{
+				Weight: power.SectorStorageWeightDesc{
+					SectorSize:         2 << 10,
+					Duration:           1,
+					DealWeight:         big.Zero(),
+					VerifiedDealWeight: big.Zero(),
+				},
+			}, big.Zero())
+			if code == exitcode.Ok {
+				panic(fmt.Sprintf("power accepted a callback from %s which it never created", powerStranger.addr))
+			}
+		default:
+			if len(peers.miners) == 0 {
+				continue
+			}
+			m := peers.miners[int(op.Miner)%len(peers.miners)]
+			worker := actorRef{m.worker, builtin.AccountActorCodeID}
+			pick := sectorsBitField(m.sectors, op.Sectors)
+			var res mockrt.Result
+			switch kind {
+			case powerOpDeclareFaults:
+				res = peers.invoke(m, worker, miner.Actor{}.DeclareFaults, &miner.DeclareFaultsParams{
+					Faults: []miner.FaultDeclaration{{Deadline: m.deadline(op.Sectors), Sectors: pick}},
+				})
+			case powerOpDeclareRecovered:
+				res = peers.invoke(m, worker, miner.Actor{}.DeclareFaultsRecovered, &miner.DeclareFaultsRecoveredParams{
+					Recoveries: []miner.RecoveryDeclaration{{Deadline: m.deadline(op.Sectors), Sectors: pick}},
+				})
+			case powerOpPoSt:
+				var mst miner.State
+				m.rt.GetState(&mst)
+				res = peers.invoke(m, worker, miner.Actor{}.SubmitWindowedPoSt, &miner.SubmitWindowedPoStParams{
+					Deadline:   mst.DeadlineInfo(peers.epoch).Index,
+					Partitions: []uint64{0},
+					Proofs:     []abi.PoStProof{{RegisteredProof: abi.RegisteredProof_StackedDRG2KiBWindowPoSt, ProofBytes: validProof}},
+					Skipped:    *sectorsBitField(m.sectors, op.Skipped),
+				})
+			case powerOpTerminate:
+				res = peers.invoke(m, worker, miner.Actor{}.TerminateSectors, &miner.TerminateSectorsParams{Sectors: pick})
+			case powerOpExtend:
+				if len(op.Sectors) == 0 {
+					continue
+				}
+				res = peers.invoke(m, worker, miner.Actor{}.ExtendSectorExpiration, &miner.ExtendSectorExpirationParams{
+					SectorNumber:  m.sectors[int(op.Sectors[0])%len(m.sectors)],
+					NewExpiration: peers.epoch + abi.ChainEpoch(op.Expiration),
+				})
+			}
+			if res.MockFailure {
+				return 0
+			}
+		}
+
+		rt.GetState(&st)
+		checkPowerState(peers, &st)
+	}
+	return 1
+}
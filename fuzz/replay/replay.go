@@ -0,0 +1,115 @@
+// Replays stored corpora and crashers through the harnesses as a regression test
+// Lets a Lotus/specs-actors version bump be checked without starting a fuzzing campaign
+
+package replay
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Environment variable pointing at the fuzzing workdir
+// Expected layout is the go-fuzz one: <workdir>/<target>/{corpus,crashers}/<input>
+const WorkdirEnv = "LOTUS_FUZZ_WORKDIR"
+
+// The directories replayed for each target
+var inputDirs = []string{"corpus", "crashers"}
+
+// Run replays every stored input for every target in targets as a subtest
+// Targets without a directory in the workdir are skipped
+func Run(t *testing.T, targets map[string]func([]byte) int) {
+	workdir := os.Getenv(WorkdirEnv)
+	if workdir == "" {
+		t.Skipf("%s not set, nothing to replay", WorkdirEnv)
+	}
+
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	// deterministic ordering makes the output diffable across version bumps
+	sort.Strings(names)
+
+	for _, name := range names {
+		harness := targets[name]
+		targetDir := filepath.Join(workdir, name)
+		t.Run(name, func(t *testing.T) {
+			if _, err := os.Stat(targetDir); os.IsNotExist(err) {
+				t.Skipf("no stored inputs in %s", targetDir)
+			}
+			for _, dir := range inputDirs {
+				replayDir(t, harness, filepath.Join(targetDir, dir))
+			}
+		})
+	}
+}
+
+func replayDir(t *testing.T, harness func([]byte) int, dir string) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("reading %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isInput(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+		if bucket, msg, crashed := replayOne(harness, data); crashed {
+			t.Errorf("%s: [%s] panic: %s", path, bucket, msg)
+		}
+	}
+}
+
+// go-fuzz stores the output and a quoted copy next to each crasher
+func isInput(name string) bool {
+	return !strings.HasSuffix(name, ".output") && !strings.HasSuffix(name, ".quoted") &&
+		!strings.HasPrefix(name, ".")
+}
+
+// replayOne runs a single input and recovers any panic, returning its bucket and
+// the first line of the panic value
+func replayOne(harness func([]byte) int, data []byte) (bucket, msg string, crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			bucket = Bucket()
+			msg = strings.SplitN(fmt.Sprint(r), "\n", 2)[0]
+			crashed = true
+		}
+	}()
+	harness(data)
+	return "", "", false
+}
+
+// Bucket groups a panic the same way across runs by where it was raised, the
+// innermost frame outside the runtime and this package. The panic value isn't
+// used, harnesses format fuzzed values into it
+// Two crashers in the same bucket are most likely the same bug
+func Bucket() string {
+	pcs := make([]uintptr, 64)
+	// skip runtime.Callers, Bucket and the deferred func in replayOne
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") && !strings.Contains(frame.Function, "/fuzz/replay.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return "unknown"
+}
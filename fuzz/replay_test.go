@@ -0,0 +1,13 @@
+package fuzz
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/replay"
+)
+
+// Replays the stored corpus and crashers of every target in Targets
+// e.g. LOTUS_FUZZ_WORKDIR=/path/to/workdir go test -run TestReplay
+func TestReplay(t *testing.T) {
+	replay.Run(t, Targets)
+}
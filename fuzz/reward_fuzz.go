@@ -0,0 +1,292 @@
+// Differential fuzzing of the reward actor's minting and block reward arithmetic
+// Supplies minted with the actor's fixed-point series and the effective network time are
+// compared with the closed forms evaluated in arbitrary precision, the same way
+// bigNodesForHeight checks nodesForHeight. Block awards carry the gas reward and penalty
+// of fuzzed messages and must hand out the block's share of the minted epoch reward.
+// Lotus only passes the gas totals to AwardBlockReward, so its reward path isn't driven
+
+package fuzz
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	abig "github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/reward"
+	vmr "github.com/filecoin-project/specs-actors/actors/runtime"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+	"github.com/filecoin-project/specs-actors/actors/util/adt"
+	gfuzz "github.com/google/gofuzz"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// from specs-actors/actors/builtin/reward/reward_logic.go, minting halves every 6 years
+const mintingHalfLife = 6 * 365 * 24 * 60 * 60 / builtin.EpochDurationSeconds
+
+// precision of the reference, far past the actor's 97 bit fixed point output
+const rewardRefPrec = 512
+
+// The actor's series is accurate to well under 2^-mintingTolerance of the total minted
+const mintingTolerance = 60
+
+// ln(2), more digits than rewardRefPrec needs
+var rewardLn2, _ = new(big.Float).SetPrec(rewardRefPrec).SetString("0.69314718055994530941723212145817656807550013436025525412068000949339362196969471560586332699641868754200148102057068573368552023575813055703267075163507596193072757082837143519030703862389167347112335")
+
+var rewardMiner = mockrt.IDAddress(102)
+
+const (
+	rewardOpUpdateKPI = iota
+	rewardOpAward
+	numRewardOps
+)
+
+// A message included in an awarded block, as far as the block reward is concerned
+type rewardMsg struct {
+	GasPrice uint32
+	GasUsed  uint32
+	Penalty  uint32
+}
+
+// One step of a reward scenario
+type rewardOp struct {
+	Kind    uint8
+	Advance uint8
+	// Realized power, shifted left by PowerShift
+	Power      uint64
+	PowerShift uint8
+	Msgs       []rewardMsg
+	WinCount   uint8
+}
+
+func newRewardState() cbg.CBORUnmarshaler {
+	return new(reward.State)
+}
+
+// expNeg is e^-x in arbitrary precision, halving x until the series converges quickly
+// and squaring the result back up
+func expNeg(x *big.Float) *big.Float {
+	y := new(big.Float).SetPrec(rewardRefPrec).Set(x)
+	half := big.NewFloat(0.5)
+	k := 0
+	for y.Cmp(half) > 0 {
+		y.Mul(y, half)
+		k++
+	}
+	// e^-y = sum (-y)^n / n!
+	sum := new(big.Float).SetPrec(rewardRefPrec).SetInt64(1)
+	term := new(big.Float).SetPrec(rewardRefPrec).SetInt64(1)
+	epsilon := new(big.Float).SetMantExp(big.NewFloat(1), -rewardRefPrec)
+	for n := int64(1); ; n++ {
+		term.Mul(term, y)
+		term.Quo(term, new(big.Float).SetInt64(-n))
+		sum.Add(sum, term)
+		if new(big.Float).Abs(term).Cmp(epsilon) < 0 {
+			break
+		}
+	}
+	for ; k > 0; k-- {
+		sum.Mul(sum, sum)
+	}
+	return sum
+}
+
+// bigMinted is total * (1 - 2^(-t/mintingHalfLife)), what has been minted after t epochs,
+// rounded down to an attoFIL
+func bigMinted(total abi.TokenAmount, t abi.ChainEpoch) *big.Int {
+	if t <= 0 {
+		return big.NewInt(0)
+	}
+	x := new(big.Float).SetPrec(rewardRefPrec).SetInt64(int64(t))
+	x.Quo(x, new(big.Float).SetInt64(mintingHalfLife))
+	x.Mul(x, rewardLn2)
+	frac := new(big.Float).SetPrec(rewardRefPrec).SetInt64(1)
+	frac.Sub(frac, expNeg(x))
+	frac.Mul(frac, new(big.Float).SetPrec(rewardRefPrec).SetInt(total.Int))
+	minted, _ := frac.Int(nil)
+	return minted
+}
+
+// bigNetworkTime is the effective network time the capped realized power adds up to:
+// the epochs of baseline power it covers, rounded down. The baseline is constant in this
+// version of the actor
+func bigNetworkTime(cumsumRealized *big.Int, baseline abi.StoragePower) abi.ChainEpoch {
+	if baseline.Int.Sign() <= 0 {
+		panic(fmt.Sprintf("baseline power %s isn't positive", baseline))
+	}
+	t := new(big.Float).SetPrec(rewardRefPrec).SetInt(cumsumRealized)
+	t.Quo(t, new(big.Float).SetPrec(rewardRefPrec).SetInt(baseline.Int))
+	n, _ := t.Int(nil)
+	if !n.IsInt64() {
+		panic(fmt.Sprintf("network time %s out of range", n))
+	}
+	return abi.ChainEpoch(n.Int64())
+}
+
+// checkMinted checks minted is what the reference gives for epoch t, allowing for the
+// actor computing it one epoch either side and for the tolerance of its series
+func checkMinted(name string, total, minted abi.TokenAmount, t abi.ChainEpoch) {
+	tol := new(big.Int).Rsh(total.Int, mintingTolerance)
+	lo := new(big.Int).Sub(bigMinted(total, t-1), tol)
+	hi := new(big.Int).Add(bigMinted(total, t+1), tol)
+	if minted.Int.Cmp(lo) < 0 || minted.Int.Cmp(hi) > 0 {
+		fmt.Printf("Input: t=%d\n", t)
+		fmt.Printf("Actor=%s\n", minted)
+		fmt.Printf("Reference=%s\n", bigMinted(total, t))
+		panic(fmt.Sprintf("%s supply out of range", name))
+	}
+	if minted.GreaterThan(total) {
+		panic(fmt.Sprintf("%s supply %s past its total %s", name, minted, total))
+	}
+}
+
+// blockGasReward sums the gas reward and penalty of the messages in a block
+func blockGasReward(msgs []rewardMsg) (gasReward, penalty abi.TokenAmount) {
+	gasReward, penalty = abig.Zero(), abig.Zero()
+	for _, m := range msgs {
+		gasReward = abig.Add(gasReward, abig.Mul(abig.NewInt(int64(m.GasPrice)), abig.NewInt(int64(m.GasUsed))))
+		penalty = abig.Add(penalty, abig.NewInt(int64(m.Penalty)))
+	}
+	return gasReward, penalty
+}
+
+// rewardPeers records where the reward actor sends funds
+type rewardPeers struct {
+	paid, burnt abi.TokenAmount
+}
+
+func (p *rewardPeers) send(to goaddr.Address, method abi.MethodNum, params vmr.CBORMarshaler, value abi.TokenAmount) (vmr.CBORMarshaler, exitcode.ExitCode) {
+	switch to {
+	case rewardMiner:
+		p.paid = abig.Add(p.paid, value)
+	case builtin.BurntFundsActorAddr:
+		p.burnt = abig.Add(p.burnt, value)
+	}
+	return nil, exitcode.Ok
+}
+
+// Fuzzing network KPI updates and block awards, minted supplies must follow the closed form
+// and every award must pay out exactly the block reward and gas reward, less the penalty
+func FuzzRewardArithmetic(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var ops []rewardOp
+	f.Fuzz(&ops)
+	if len(ops) > maxScenarioSteps {
+		ops = ops[:maxScenarioSteps]
+	}
+
+	funds := abig.Add(reward.SimpleTotal, reward.BaselineTotal)
+	rt := mockrt.NewRuntime(builtin.RewardActorAddr, 0, funds)
+	peers := &rewardPeers{}
+	rt.OnSend = peers.send
+	actor := reward.Actor{}
+
+	rt.SetCaller(builtin.SystemActorAddr, builtin.SystemActorCodeID)
+	rt.ExpectValidateCallerAddr(builtin.SystemActorAddr)
+	res := mockrt.InvokeReverting(rt, newRewardState, actor.Constructor, (*adt.EmptyValue)(nil))
+	if res.MockFailure || res.Aborted {
+		return 0
+	}
+
+	var prev, st reward.State
+	rt.GetState(&prev)
+	// realized power counts up to the baseline towards network time
+	cumsum := new(big.Int).Set(prev.CumsumRealized.Int)
+	epoch := abi.ChainEpoch(0)
+	for _, op := range ops {
+		epoch += abi.ChainEpoch(op.Advance)
+		rt.SetEpoch(epoch)
+
+		switch int(op.Kind) % numRewardOps {
+		case rewardOpUpdateKPI:
+			realized := abig.Int{Int: new(big.Int).Lsh(new(big.Int).SetUint64(op.Power), uint(op.PowerShift%64))}
+			rt.SetCaller(builtin.StoragePowerActorAddr, builtin.StoragePowerActorCodeID)
+			rt.ExpectValidateCallerAddr(builtin.StoragePowerActorAddr)
+			res = mockrt.InvokeReverting(rt, newRewardState, actor.UpdateNetworkKPI, &realized)
+			if res.MockFailure {
+				return 0
+			}
+			if res.Aborted {
+				panic(fmt.Sprintf("UpdateNetworkKPI aborted with %d", res.Code))
+			}
+			rt.GetState(&st)
+			if realized.GreaterThan(st.BaselinePower) {
+				cumsum.Add(cumsum, st.BaselinePower.Int)
+			} else {
+				cumsum.Add(cumsum, realized.Int)
+			}
+			if st.CumsumRealized.Int.Cmp(cumsum) != 0 {
+				panic(fmt.Sprintf("cumulative realized power %s, reference %s", st.CumsumRealized, cumsum))
+			}
+			networkTime := bigNetworkTime(cumsum, st.BaselinePower)
+			if st.EffectiveNetworkTime < networkTime-1 || st.EffectiveNetworkTime > networkTime+1 {
+				fmt.Printf("Input: cumsum=%s, baseline=%s\n", cumsum, st.BaselinePower)
+				fmt.Printf("Actor=%d\n", st.EffectiveNetworkTime)
+				fmt.Printf("Reference=%d\n", networkTime)
+				panic("effective network time out of range")
+			}
+			checkMinted("simple", reward.SimpleTotal, st.SimpleSupply, epoch)
+			checkMinted("baseline", reward.BaselineTotal, st.BaselineSupply, networkTime)
+			// the epoch reward is what this update minted
+			minted := abig.Add(abig.Sub(st.SimpleSupply, prev.SimpleSupply), abig.Sub(st.BaselineSupply, prev.BaselineSupply))
+			if !st.LastPerEpochReward.Equals(minted) {
+				panic(fmt.Sprintf("epoch reward %s, but %s was minted", st.LastPerEpochReward, minted))
+			}
+			if st.EffectiveNetworkTime > epoch+1 {
+				panic(fmt.Sprintf("effective network time %d ahead of epoch %d", st.EffectiveNetworkTime, epoch))
+			}
+			if st.EffectiveNetworkTime < prev.EffectiveNetworkTime || st.SimpleSupply.LessThan(prev.SimpleSupply) || st.BaselineSupply.LessThan(prev.BaselineSupply) {
+				panic(fmt.Sprintf("minting went backwards: time %d->%d, simple %s->%s, baseline %s->%s",
+					prev.EffectiveNetworkTime, st.EffectiveNetworkTime, prev.SimpleSupply, st.SimpleSupply, prev.BaselineSupply, st.BaselineSupply))
+			}
+			if st.LastPerEpochReward.LessThan(abig.Zero()) {
+				panic(fmt.Sprintf("negative epoch reward %s", st.LastPerEpochReward))
+			}
+			prev = st
+
+		case rewardOpAward:
+			gasReward, penalty := blockGasReward(op.Msgs)
+			winCount := int64(op.WinCount%builtin.ExpectedLeadersPerEpoch) + 1
+			// the gas reward reaches the reward actor before the block is awarded
+			rt.SetBalance(abig.Add(rt.Balance, gasReward))
+
+			rt.GetState(&st)
+			peers.paid, peers.burnt = abig.Zero(), abig.Zero()
+			before := rt.Balance
+			rt.SetCaller(builtin.SystemActorAddr, builtin.SystemActorCodeID)
+			rt.ExpectValidateCallerAddr(builtin.SystemActorAddr)
+			res = mockrt.InvokeReverting(rt, newRewardState, actor.AwardBlockReward, &reward.AwardBlockRewardParams{
+				Miner:     rewardMiner,
+				Penalty:   penalty,
+				GasReward: gasReward,
+				WinCount:  winCount,
+			})
+			if res.MockFailure {
+				return 0
+			}
+			if res.Aborted {
+				panic(fmt.Sprintf("AwardBlockReward aborted with %d", res.Code))
+			}
+			// the block's share of the epoch reward the last update minted, before the penalty
+			share := abig.Sub(abig.Add(peers.paid, peers.burnt), gasReward)
+			won := abig.Mul(st.LastPerEpochReward, abig.NewInt(winCount))
+			leaders := abig.NewInt(builtin.ExpectedLeadersPerEpoch)
+			if share.LessThan(abig.Zero()) || abig.Mul(share, leaders).GreaterThan(won) || !abig.Mul(abig.Add(share, abig.NewInt(1)), leaders).GreaterThan(won) {
+				fmt.Printf("Input: reward=%s, gas=%s, penalty=%s, wins=%d\n", st.LastPerEpochReward, gasReward, penalty, winCount)
+				fmt.Printf("Actor: paid=%s, burnt=%s\n", peers.paid, peers.burnt)
+				panic(fmt.Sprintf("block share %s isn't %d of %d leaders' share of the epoch reward", share, winCount, builtin.ExpectedLeadersPerEpoch))
+			}
+			// the penalty is burnt from what the miner gets, never more
+			if !peers.burnt.Equals(abig.Min(penalty, abig.Add(share, gasReward))) {
+				panic(fmt.Sprintf("burnt %s for penalty %s out of %s", peers.burnt, penalty, abig.Add(share, gasReward)))
+			}
+			if spent := abig.Sub(before, rt.Balance); !spent.Equals(abig.Add(peers.paid, peers.burnt)) {
+				panic(fmt.Sprintf("reward actor balance fell by %s, sent %s", spent, abig.Add(peers.paid, peers.burnt)))
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,34 @@
+package fuzz
+
+// Targets maps each harness name, as passed to -func, to the harness itself
+// Keep in sync when adding harnesses so they get replayed as regression tests
+var Targets = map[string]func([]byte) int{
+	"FuzzBlockMsg":              FuzzBlockMsg,
+	"FuzzBlockMsgStructural":    FuzzBlockMsgStructural,
+	"FuzzBlockHeader":           FuzzBlockHeader,
+	"FuzzNodesForHeight":        FuzzNodesForHeight,
+	"FuzzHamtOps":               FuzzHamtOps,
+	"FuzzAmtOps":                FuzzAmtOps,
+	"FuzzHamtPlantedRaw":        FuzzHamtPlantedRaw,
+	"FuzzAmtPlantedRaw":         FuzzAmtPlantedRaw,
+	"FuzzHamtPlantedStructured": FuzzHamtPlantedStructured,
+	"FuzzAmtPlantedStructured":  FuzzAmtPlantedStructured,
+	"FuzzBitfieldRaw":           FuzzBitfieldRaw,
+	"FuzzBitfieldSetOps":        FuzzBitfieldSetOps,
+	"FuzzBitfieldRuns":          FuzzBitfieldRuns,
+	"FuzzAddressFromString":     FuzzAddressFromString,
+	"FuzzAddressFromBytes":      FuzzAddressFromBytes,
+	"FuzzAddressJSON":           FuzzAddressJSON,
+	"FuzzMessageCidRaw":         FuzzMessageCidRaw,
+	"FuzzSignedMessageCidRaw":   FuzzSignedMessageCidRaw,
+	"FuzzMessageCidStructured":  FuzzMessageCidStructured,
+	"FuzzActorDispatch":         FuzzActorDispatch,
+	"FuzzMultisigScenario":      FuzzMultisigScenario,
+	"FuzzMarketDeals":           FuzzMarketDeals,
+	"FuzzMinerScenario":         FuzzMinerScenario,
+	"FuzzPowerScenario":         FuzzPowerScenario,
+	"FuzzVerifregAllowances":    FuzzVerifregAllowances,
+	"FuzzInitExec":              FuzzInitExec,
+	"FuzzRewardArithmetic":      FuzzRewardArithmetic,
+	"FuzzCronEpochTick":         FuzzCronEpochTick,
+}
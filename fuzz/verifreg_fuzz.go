@@ -0,0 +1,210 @@
+// Stateful fuzzing of verified registry allowances
+// Root, verifiers, clients and the market call the registry in the specs-actors mock
+// runtime, allowances are tracked so DataCap can be checked to be conserved
+
+package fuzz
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/fuzzing-lotus/fuzz/mockrt"
+	goaddr "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/verifreg"
+	gfuzz "github.com/google/gofuzz"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+var (
+	verifregRoot = mockrt.IDAddress(105)
+	// Verifiers, clients and someone who is neither, any of them can be named in params
+	verifregParties = []goaddr.Address{
+		mockrt.IDAddress(110), mockrt.IDAddress(111),
+		mockrt.IDAddress(120), mockrt.IDAddress(121),
+		mockrt.IDAddress(130),
+	}
+)
+
+// Upper bound on a fuzzed allowance or deal size
+const maxVerifregAmount = 1 << 40
+
+const (
+	verifregOpAddVerifier = iota
+	verifregOpRemoveVerifier
+	verifregOpAddClient
+	verifregOpUseBytes
+	verifregOpRestoreBytes
+	numVerifregOps
+)
+
+// One step of a verified registry scenario
+type verifregOp struct {
+	Kind uint8
+	// Index into root, the parties and the market actor
+	Caller uint8
+	// Index into the parties
+	Target uint8
+	Amount uint64
+}
+
+func newVerifregState() cbg.CBORUnmarshaler {
+	return new(verifreg.State)
+}
+
+// verifregCaller resolves a fuzzed caller index to an address and its code
+func verifregCaller(i uint8) actorRef {
+	n := int(i) % (len(verifregParties) + 2)
+	switch {
+	case n < len(verifregParties):
+		return actorRef{verifregParties[n], builtin.AccountActorCodeID}
+	case n == len(verifregParties):
+		return actorRef{verifregRoot, builtin.AccountActorCodeID}
+	}
+	return actorRef{builtin.StorageMarketActorAddr, builtin.StorageMarketActorCodeID}
+}
+
+// dataCaps reads the verifier and client tables, checking no DataCap went negative
+func dataCaps(rt *mockrt.Runtime, st *verifreg.State) (verifiers, clients map[goaddr.Address]abi.TokenAmount, total big.Int) {
+	verifiers = balanceTable(rt, st.Verifiers)
+	clients = balanceTable(rt, st.VerifiedClients)
+	total = big.Zero()
+	for _, table := range []map[goaddr.Address]abi.TokenAmount{verifiers, clients} {
+		for a, c := range table {
+			if c.LessThan(big.Zero()) {
+				panic(fmt.Sprintf("negative DataCap %s for %s", c, a))
+			}
+			total = big.Add(total, c)
+		}
+	}
+	return verifiers, clients, total
+}
+
+// capOf is the DataCap in a table, zero for addresses not in it
+func capOf(table map[goaddr.Address]abi.TokenAmount, a goaddr.Address) big.Int {
+	if c, ok := table[a]; ok {
+		return c
+	}
+	return big.Zero()
+}
+
+// Fuzzing verified registry allowances, DataCap only moves between verifiers and clients
+// or to and from deals, and only the right callers can move it
+func FuzzVerifregAllowances(data []byte) int {
+	f := gfuzz.NewFromGoFuzz(data).NilChance(0)
+	var ops []verifregOp
+	f.Fuzz(&ops)
+	if len(ops) > maxScenarioSteps {
+		ops = ops[:maxScenarioSteps]
+	}
+
+	rt := mockrt.NewRuntime(builtin.VerifiedRegistryActorAddr, 0, big.Zero())
+	actor := verifreg.Actor{}
+	root := verifregRoot
+	if !construct(rt, actor.Exports(), systemCaller, expectAddr(builtin.SystemActorAddr), &root) {
+		return 0
+	}
+
+	var st verifreg.State
+	for _, op := range ops {
+		rt.GetState(&st)
+		verifiers, clients, total := dataCaps(rt, &st)
+
+		caller := verifregCaller(op.Caller)
+		target := verifregParties[int(op.Target)%len(verifregParties)]
+		amount := big.NewIntUnsigned(op.Amount % maxVerifregAmount)
+		rt.SetCaller(caller.addr, caller.code)
+
+		var method, params interface{}
+		// authorized says whether the caller may make the call at all
+		var authorized bool
+		switch int(op.Kind) % numVerifregOps {
+		case verifregOpAddVerifier:
+			rt.ExpectValidateCallerAddr(st.RootKey)
+			method, params = actor.AddVerifier, &verifreg.AddVerifierParams{Address: target, Allowance: amount}
+			authorized = caller.addr == st.RootKey
+		case verifregOpRemoveVerifier:
+			rt.ExpectValidateCallerAddr(st.RootKey)
+			method, params = actor.RemoveVerifier, &target
+			authorized = caller.addr == st.RootKey
+		case verifregOpAddClient:
+			rt.ExpectValidateCallerAny()
+			method, params = actor.AddVerifiedClient, &verifreg.AddVerifiedClientParams{Address: target, Allowance: amount}
+			_, authorized = verifiers[caller.addr]
+		case verifregOpUseBytes:
+			rt.ExpectValidateCallerAddr(builtin.StorageMarketActorAddr)
+			method, params = actor.UseBytes, &verifreg.UseBytesParams{Address: target, DealSize: amount}
+			authorized = caller.addr == builtin.StorageMarketActorAddr
+		case verifregOpRestoreBytes:
+			rt.ExpectValidateCallerAddr(builtin.StorageMarketActorAddr)
+			method, params = actor.RestoreBytes, &verifreg.RestoreBytesParams{Address: target, DealSize: amount}
+			authorized = caller.addr == builtin.StorageMarketActorAddr
+		}
+
+		res := mockrt.InvokeChecked(rt, newVerifregState, method, params)
+		if res.MockFailure {
+			return 0
+		}
+		if res.Aborted {
+			rt.Reset()
+			continue
+		}
+		if !mockrt.ExpectationsMet(rt) {
+			panic(fmt.Sprintf("method %d succeeded without validating its caller", op.Kind%numVerifregOps))
+		}
+		rt.Reset()
+		if !authorized {
+			panic(fmt.Sprintf("unauthorized caller %s made call %d", caller.addr, op.Kind%numVerifregOps))
+		}
+
+		rt.GetState(&st)
+		afterVerifiers, afterClients, afterTotal := dataCaps(rt, &st)
+		switch int(op.Kind) % numVerifregOps {
+		case verifregOpAddVerifier:
+			expected := big.Add(big.Sub(total, capOf(verifiers, target)), amount)
+			if !afterTotal.Equals(expected) || !capOf(afterVerifiers, target).Equals(amount) {
+				panic(fmt.Sprintf("AddVerifier of %s for %s left %s in total, expected %s", amount, target, afterTotal, expected))
+			}
+		case verifregOpRemoveVerifier:
+			if _, ok := afterVerifiers[target]; ok {
+				panic(fmt.Sprintf("verifier %s still there after being removed", target))
+			}
+			expected := big.Sub(total, capOf(verifiers, target))
+			if !afterTotal.Equals(expected) {
+				panic(fmt.Sprintf("RemoveVerifier of %s left %s in total, expected %s", target, afterTotal, expected))
+			}
+		case verifregOpAddClient:
+			if !afterTotal.Equals(total) {
+				panic(fmt.Sprintf("AddVerifiedClient changed the total DataCap from %s to %s", total, afterTotal))
+			}
+			spent := big.Sub(capOf(verifiers, caller.addr), capOf(afterVerifiers, caller.addr))
+			granted := big.Sub(capOf(afterClients, target), capOf(clients, target))
+			if !spent.Equals(amount) || !granted.Equals(amount) {
+				panic(fmt.Sprintf("verifier %s spent %s granting %s to %s, allowance was %s", caller.addr, spent, granted, target, amount))
+			}
+		case verifregOpUseBytes:
+			before := capOf(clients, target)
+			if before.LessThan(amount) {
+				panic(fmt.Sprintf("client %s used %s with a DataCap of %s", target, amount, before))
+			}
+			after, ok := afterClients[target]
+			remaining := big.Sub(before, amount)
+			if ok && !after.Equals(remaining) {
+				panic(fmt.Sprintf("client %s has %s after using %s of %s", target, after, amount, before))
+			}
+			if !ok && remaining.GreaterThanEqual(verifreg.MinVerifiedDealSize) {
+				panic(fmt.Sprintf("client %s removed with %s left", target, remaining))
+			}
+			if !afterTotal.Equals(big.Sub(total, big.Sub(before, capOf(afterClients, target)))) {
+				panic(fmt.Sprintf("UseBytes changed DataCap other than %s's", target))
+			}
+		case verifregOpRestoreBytes:
+			expected := big.Add(capOf(clients, target), amount)
+			if !capOf(afterClients, target).Equals(expected) || !afterTotal.Equals(big.Add(total, amount)) {
+				panic(fmt.Sprintf("RestoreBytes of %s to %s left %s, expected %s", amount, target, capOf(afterClients, target), expected))
+			}
+		}
+	}
+	return 1
+}